@@ -0,0 +1,188 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// ErrAsyncClosed is returned by Put and Flush in asynchronous mode once the
+// store is closed, see WithAsyncWrites.
+var ErrAsyncClosed = errors.New("asynchronous writer closed")
+
+// asyncWrite is a node write queued by Put in asynchronous mode, or, with a
+// non-nil flushed, a Flush waiting for the writes queued before it.
+type asyncWrite struct {
+	key   []byte
+	node  *merkletree.Node
+	id    string
+	value interface{}
+	seq   uint64
+
+	flushed chan error
+}
+
+// asyncWriter writes the nodes queued by Put in the background, see
+// WithAsyncWrites.
+type asyncWriter struct {
+	s      *Storage
+	writes chan asyncWrite
+	done   chan struct{}
+
+	// mu guards closed; queueing holds it for reading so Close doesn't close
+	// writes under a sender.
+	mu     sync.RWMutex
+	closed bool
+
+	// err is the first error since the last Flush. Only the writer goroutine
+	// accesses it.
+	err error
+}
+
+func newAsyncWriter(s *Storage, bufferSize int) *asyncWriter {
+	w := &asyncWriter{
+		s:      s,
+		writes: make(chan asyncWrite, bufferSize),
+		done:   make(chan struct{}),
+	}
+	go w.run(bufferSize)
+	return w
+}
+
+// queue adds a write or flush request, waiting for room in the buffer.
+func (w *asyncWriter) queue(ctx context.Context, op asyncWrite) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrAsyncClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case w.writes <- op:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run writes the queued nodes until the queue is closed, in pipelines of the
+// writes that are waiting, up to maxBatch.
+func (w *asyncWriter) run(maxBatch int) {
+	defer close(w.done)
+	var batch []asyncWrite
+	for op := range w.writes {
+		batch = append(batch[:0], op)
+	drain:
+		for len(batch) < maxBatch {
+			select {
+			case op, ok := <-w.writes:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, op)
+			default:
+				break drain
+			}
+		}
+		w.write(batch)
+	}
+}
+
+// write writes the nodes of batch and answers its flush requests, each after
+// the writes queued before it.
+func (w *asyncWriter) write(batch []asyncWrite) {
+	start := 0
+	for i, op := range batch {
+		if op.flushed == nil {
+			continue
+		}
+		w.writeNodes(batch[start:i])
+		start = i + 1
+		op.flushed <- w.err
+		w.err = nil
+	}
+	w.writeNodes(batch[start:])
+}
+
+func (w *asyncWriter) writeNodes(ops []asyncWrite) {
+	if len(ops) == 0 {
+		return
+	}
+	s := w.s
+	ctx, cancel := s.withTimeout(context.Background())
+	defer cancel()
+
+	keys := make([][]byte, len(ops))
+	ids := make([]string, len(ops))
+	values := make([]interface{}, len(ops))
+	for i, op := range ops {
+		keys[i], ids[i], values[i] = op.key, op.id, op.value
+	}
+	err := s.retry(ctx, func() error {
+		return s.setNodes(ctx, keys, ids, values)
+	})
+	if err == nil {
+		for _, op := range ops {
+			s.nodeCache.add(op.key, op.node)
+			if ackErr := s.wal.ack(op.seq); ackErr != nil && err == nil {
+				err = ackErr
+			}
+		}
+	} else {
+		for _, op := range ops {
+			s.abortWrites(op.seq, err)
+		}
+	}
+	if err == nil {
+		return
+	}
+	if w.err == nil {
+		w.err = err
+	}
+	if s.asyncErrorHandler != nil {
+		s.asyncErrorHandler(err)
+	} else {
+		s.errorf("asynchronous write of %d nodes failed: %v", len(ops), err)
+	}
+}
+
+// close stops accepting writes, waits for the queued ones and returns the
+// first error since the last Flush.
+func (w *asyncWriter) close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.writes)
+	w.mu.Unlock()
+	<-w.done
+	return w.err
+}
+
+// Flush waits until the nodes queued by Put before it are written, in
+// asynchronous mode, and returns the first error writing nodes since the
+// previous Flush. Without WithAsyncWrites it does nothing.
+func (s *Storage) Flush(ctx context.Context) error {
+	if s.async == nil {
+		return nil
+	}
+	flushed := make(chan error, 1)
+	if err := s.async.queue(ctx, asyncWrite{flushed: flushed}); err != nil {
+		return err
+	}
+	select {
+	case err := <-flushed:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
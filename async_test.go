@@ -0,0 +1,133 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+)
+
+func TestAsyncWrites(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "async", WithAsyncWrites(16), WithNodeCounter())
+
+	kvs := testLeafKVs(500)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(kvs); i += 4 {
+				if err := s.Put(ctx, kvs[i].K, &kvs[i].V); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh := NewMerkleRedisStorage(srv.Client(t), "async")
+	found, err := fresh.HasMulti(ctx, keysOf(kvs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ok := range found {
+		if !ok {
+			t.Fatalf("node %d missing after Flush", i)
+		}
+	}
+	if n, err := s.NodeCount(ctx); err != nil || n != int64(len(kvs)) {
+		t.Fatalf("NodeCount: got %d, %v, want %d", n, err, len(kvs))
+	}
+
+	// Close writes what is still queued
+	more := testLeafKVs(520)[500:]
+	for _, kv := range more {
+		if err := s.Put(ctx, kv.K, &kv.V); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range more {
+		if _, err := fresh.Get(ctx, kv.K); err != nil {
+			t.Fatalf("node queued before Close: %v", err)
+		}
+	}
+	if err := s.Put(ctx, kvs[0].K, &kvs[0].V); err != ErrAsyncClosed {
+		t.Fatalf("Put after Close: got %v, want ErrAsyncClosed", err)
+	}
+	if err := s.Flush(ctx); err != ErrAsyncClosed {
+		t.Fatalf("Flush after Close: got %v, want ErrAsyncClosed", err)
+	}
+}
+
+func TestAsyncWriteErrors(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	var mu sync.Mutex
+	var handled []error
+	s := NewMerkleRedisStorageUniversal(crashingClient{UniversalClient: srv.Client(t)}, "asyncerr",
+		WithAsyncWrites(4),
+		WithAsyncErrorHandler(func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, err)
+		}))
+	defer s.Close()
+
+	kvs := testLeafKVs(10)
+	for _, kv := range kvs {
+		if err := s.Put(ctx, kv.K, &kv.V); err != nil {
+			t.Fatalf("Put: got %v, want the error deferred", err)
+		}
+	}
+	if err := s.Flush(ctx); !errors.Is(err, errCrash) {
+		t.Fatalf("Flush: got %v, want the write error", err)
+	}
+	mu.Lock()
+	if len(handled) == 0 || !errors.Is(handled[0], errCrash) {
+		t.Fatalf("handler got %v", handled)
+	}
+	mu.Unlock()
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("second Flush: got %v, want the error reported once", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := s.Flush(canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Flush with a canceled context: got %v", err)
+	}
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncWritesDerivedStores(t *testing.T) {
+	s, _ := newTestStorage(t, "asyncderived")
+	parent := NewMerkleRedisStorageUniversal(s.db, "asyncderived", WithAsyncWrites(8))
+	defer parent.Close()
+	if parent.async == nil || parent.WithPrefix("child").async != nil {
+		t.Fatal("derived store writes asynchronously")
+	}
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush without WithAsyncWrites: %v", err)
+	}
+}
+
+func keysOf(kvs []KV) [][]byte {
+	keys := make([][]byte, len(kvs))
+	for i := range kvs {
+		keys[i] = kvs[i].K
+	}
+	return keys
+}
@@ -0,0 +1,143 @@
+package merkleredis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// PutBatch stores all the given nodes in a single pipelined round-trip,
+// returning the first error encountered. With WithPerKeyDeadline the error is
+// a *PartialError if only some of the nodes were stored.
+func (s *Storage) PutBatch(ctx context.Context, kvs []KV) error {
+	if len(kvs) == 0 {
+		return nil
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	keys := make([][]byte, len(kvs))
+	ids := make([]string, len(kvs))
+	values := make([]interface{}, len(kvs))
+	var items []*NodeItem
+	for i := range kvs {
+		item, err := NewNodeItemFromNode(kvs[i].K, &kvs[i].V)
+		if err != nil {
+			return err
+		}
+		if values[i], err = s.encodeNodeItem(item); err != nil {
+			return err
+		}
+		if s.wal != nil {
+			items = append(items, item)
+		}
+		keys[i] = kvs[i].K
+		ids[i] = s.getRedisNodeIdForMerkleKey(kvs[i].K)
+	}
+	seq, err := s.logWrites(items, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.setNodes(ctx, keys, ids, values); err != nil {
+		return s.abortWrites(seq, err)
+	}
+	if err := s.wal.ack(seq); err != nil {
+		return err
+	}
+	for i := range kvs {
+		s.nodeCache.add(kvs[i].K, &kvs[i].V)
+	}
+	return nil
+}
+
+// setNodes writes the encoded node values to the node keys ids of keys in
+// one pipeline, or one per segment with WithPerKeyDeadline, and adds the nodes
+// that didn't exist before to the node counter.
+func (s *Storage) setNodes(ctx context.Context, keys [][]byte, ids []string, values []interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cmds := make([]*redis.StatusCmd, len(ids))
+	failed, err := s.runSegments(ctx, s.db, ids, func(ctx context.Context, idx []int) error {
+		pipe := s.db.Pipeline()
+		for _, i := range idx {
+			if s.nodeCounter {
+				cmds[i] = pipe.SetArgs(ctx, ids[i], values[i], redis.SetArgs{TTL: s.ttl, Get: true})
+			} else {
+				cmds[i] = pipe.Set(ctx, ids[i], values[i], s.ttl)
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return newErr(err, "failed to write node batch")
+		}
+		return nil
+	})
+	if err != nil && failed == nil {
+		return err
+	}
+	if s.nodeCounter {
+		var added int64
+		for _, cmd := range cmds {
+			if cmd.Err() == redis.Nil {
+				added++
+			}
+		}
+		if added > 0 {
+			if err := s.db.IncrBy(ctx, s.rootId+nodeCountSuffix, added).Err(); err != nil {
+				return newErr(err, "failed to update node count")
+			}
+		}
+	}
+	if err != nil {
+		return newPartialError(keys, failed, err)
+	}
+	return nil
+}
+
+// GetMulti retrieves the nodes stored under keys with a single MGET. The
+// result is aligned with keys, holding nil for keys that have no node. On Redis
+// Cluster all keys must hash to the same slot.
+func (s *Storage) GetMulti(ctx context.Context, keys [][]byte) ([]*merkletree.Node, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.getMulti(ctx, s.reader(), keys)
+}
+
+// getMulti is GetMulti reading from c.
+func (s *Storage) getMulti(ctx context.Context, c redis.Cmdable, keys [][]byte) ([]*merkletree.Node, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = s.getRedisNodeIdForMerkleKey(k)
+	}
+	vals, err := c.MGet(ctx, ids...).Result()
+	if err != nil {
+		return nil, newErr(err, "failed to read node batch")
+	}
+	nodes := make([]*merkletree.Node, len(keys))
+	for i, v := range vals {
+		if v == nil {
+			continue
+		}
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected MGET reply %T", v)
+		}
+		item, err := s.decodeNodeItem(str)
+		if err != nil {
+			return nil, err
+		}
+		if nodes[i], err = item.Node(); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
@@ -0,0 +1,100 @@
+package merkleredis
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func testLeafKVs(n int) []KV {
+	kvs := make([]KV, n)
+	for i := range kvs {
+		var k, v merkletree.Hash
+		binary.BigEndian.PutUint64(k[:], uint64(i))
+		binary.BigEndian.PutUint64(v[:], uint64(i)+1)
+		kvs[i] = KV{K: k[:], V: *merkletree.NewNodeLeaf(&k, &v)}
+	}
+	return kvs
+}
+
+func TestPutBatch(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "batch")
+
+	kvs := testLeafKVs(100)
+	if err := s.PutBatch(ctx, kvs); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Count("SET"); n != len(kvs) {
+		t.Fatalf("got %d SET commands, want %d", n, len(kvs))
+	}
+	for _, kv := range kvs {
+		got, err := s.Get(ctx, kv.K)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Type != kv.V.Type || *got.Entry[0] != *kv.V.Entry[0] || *got.Entry[1] != *kv.V.Entry[1] {
+			t.Fatalf("key %x: got %+v, want %+v", kv.K, got, kv.V)
+		}
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "mget")
+
+	kvs := testLeafKVs(4)
+	if err := s.PutBatch(ctx, []KV{kvs[0], kvs[2]}); err != nil {
+		t.Fatal(err)
+	}
+	keys := [][]byte{kvs[0].K, kvs[1].K, kvs[2].K, kvs[3].K}
+	nodes, err := s.GetMulti(ctx, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != len(keys) {
+		t.Fatalf("got %d nodes, want %d", len(nodes), len(keys))
+	}
+	for i, present := range []bool{true, false, true, false} {
+		if !present {
+			if nodes[i] != nil {
+				t.Fatalf("nodes[%d]: got %+v, want nil", i, nodes[i])
+			}
+			continue
+		}
+		if nodes[i] == nil || *nodes[i].Entry[1] != *kvs[i].V.Entry[1] {
+			t.Fatalf("nodes[%d]: got %+v, want %+v", i, nodes[i], kvs[i].V)
+		}
+	}
+	if n := srv.Count("MGET"); n != 1 {
+		t.Fatalf("got %d MGET commands, want 1", n)
+	}
+}
+
+func BenchmarkPutSequential10k(b *testing.B) {
+	ctx := context.Background()
+	s, _ := newTestStorage(b, "bench")
+	kvs := testLeafKVs(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range kvs {
+			if err := s.Put(ctx, kvs[j].K, &kvs[j].V); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkPutBatch10k(b *testing.B) {
+	ctx := context.Background()
+	s, _ := newTestStorage(b, "bench")
+	kvs := testLeafKVs(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := s.PutBatch(ctx, kvs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package merkleredis
+
+import (
+	"context"
+	"encoding/hex"
+	"strconv"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+)
+
+// The benchmarks below are the performance baseline of the hot paths, run
+// against the fake server; run them with -benchmem, or read the allocs/op they
+// report anyway. The encoding sub-benchmarks compare raw values with the hex
+// values of WithHexEncoding, and the key sub-benchmarks the node key builder
+// with the hex.EncodeToString concatenation it replaced.
+
+// benchEncodings are the value encodings the benchmarks compare.
+var benchEncodings = []struct {
+	name string
+	opts []Option
+}{
+	{"raw", nil},
+	{"hex", []Option{WithHexEncoding()}},
+}
+
+func Benchmark_Put(b *testing.B) {
+	ctx := context.Background()
+	kvs := testLeafKVs(1000)
+	for _, bc := range benchEncodings {
+		b.Run(bc.name, func(b *testing.B) {
+			srv := fakeredis.New(b)
+			s := NewMerkleRedisStorage(srv.Client(b), "bench", bc.opts...)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				kv := &kvs[i%len(kvs)]
+				if err := s.Put(ctx, kv.K, &kv.V); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func Benchmark_Get(b *testing.B) {
+	ctx := context.Background()
+	kvs := testLeafKVs(1000)
+	for _, bc := range benchEncodings {
+		b.Run(bc.name, func(b *testing.B) {
+			srv := fakeredis.New(b)
+			s := NewMerkleRedisStorage(srv.Client(b), "bench", bc.opts...)
+			if err := s.PutBatch(ctx, kvs); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.Get(ctx, kvs[i%len(kvs)].K); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func Benchmark_GetRoot(b *testing.B) {
+	ctx := context.Background()
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"cached", nil},
+		// a 1ns cache TTL reloads the root from Redis on every call
+		{"uncached", []Option{WithRootInvalidation(RootCacheTTL(1))}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			srv := fakeredis.New(b)
+			s := NewMerkleRedisStorage(srv.Client(b), "bench", bc.opts...)
+			if err := s.SetRoot(ctx, testHash(1)); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetRoot(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func Benchmark_PutBatch(b *testing.B) {
+	ctx := context.Background()
+	kvs := testLeafKVs(100)
+	for _, bc := range benchEncodings {
+		b.Run(bc.name, func(b *testing.B) {
+			srv := fakeredis.New(b)
+			s := NewMerkleRedisStorage(srv.Client(b), "bench", bc.opts...)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.PutBatch(ctx, kvs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func Benchmark_NodeKey(b *testing.B) {
+	s := NewMerkleRedisStorage(nil, "bench")
+	key := testHash(1)[:]
+	var id string
+	b.Run("builder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			id = s.getRedisNodeIdForMerkleKey(key)
+		}
+	})
+	b.Run("concat", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			id = s.nodeIdPrefix + hex.EncodeToString(key)
+		}
+	})
+	_ = id
+}
+
+// benchScanNodes is the size of the tree Benchmark_ScanBatch lists.
+const benchScanNodes = 100000
+
+func Benchmark_ScanBatch(b *testing.B) {
+	ctx := context.Background()
+	srv := fakeredis.New(b)
+	seed := NewMerkleRedisStorage(srv.Client(b), "bench")
+	kvs := testLeafKVs(benchScanNodes)
+	for start := 0; start < len(kvs); start += 10000 {
+		if err := seed.PutBatch(ctx, kvs[start:start+10000]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for _, count := range []int{100, 1000, 10000} {
+		b.Run(strconv.Itoa(count), func(b *testing.B) {
+			s := NewMerkleRedisStorage(srv.Client(b), "bench", WithScanBatch(count))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				listed, err := s.List(ctx, 0)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(listed) != benchScanNodes {
+					b.Fatalf("listed %d nodes, want %d", len(listed), benchScanNodes)
+				}
+			}
+		})
+	}
+}
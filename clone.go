@@ -0,0 +1,52 @@
+package merkleredis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// Clone copies the tree to newPrefix and returns a Storage for the copy, on the
+// same client and with the same options, which neither owns the client nor
+// uses the write-ahead log set with WithWAL. The copy is independent: writes to
+// either tree don't affect the other. Nodes are copied a SCAN page at a time
+// with pipelined reads and writes, and the root last, so a reader of the new
+// prefix never sees a root whose nodes are missing. Writes to this tree made
+// during the copy may or may not be part of it. A tree already stored under
+// newPrefix gets its root replaced; its nodes are kept alongside the copied
+// ones.
+func (s *Storage) Clone(ctx context.Context, newPrefix string) (*Storage, error) {
+	opts := s.derivedOptions()
+	clone := NewMerkleRedisStorageUniversal(s.db, newPrefix, opts...)
+
+	// read the root first: its nodes were written before it, so the scan
+	// below is guaranteed to see them
+	root, err := s.readRaw(ctx, s.rootId)
+	hasRoot := err == nil
+	if err != nil && err != redis.Nil {
+		return nil, newErr(err, "failed to read root")
+	}
+
+	err = s.scanNodeKeys(ctx, func(keys []string) error {
+		to := make([]string, len(keys))
+		for i, k := range keys {
+			to[i] = clone.nodeIdPrefix + strings.TrimPrefix(k, s.nodeIdPrefix)
+		}
+		return s.copyKeys(ctx, keys, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if hasRoot {
+		if err := clone.writeRaw(ctx, clone.rootId, root); err != nil {
+			return nil, newErr(err, "failed to write root")
+		}
+	}
+	if clone.nodeCounter {
+		if _, err := clone.RebuildNodeCount(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return clone, nil
+}
@@ -0,0 +1,80 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestClone(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStorage(t, "orig")
+	orig := newTestTree(t, s, 6)
+	origRoot := *orig.Root()
+	origNodes, err := s.NodeCount(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := s.Clone(ctx, "branch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.prefix != "branch" || c.ownsClient {
+		t.Fatalf("clone: got prefix %q, ownsClient %v", c.prefix, c.ownsClient)
+	}
+	if n, err := c.NodeCount(ctx); err != nil || n != origNodes {
+		t.Fatalf("clone node count: got %d, %v, want %d", n, err, origNodes)
+	}
+
+	branch, err := merkletree.NewMerkleTree(ctx, c, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *branch.Root() != origRoot {
+		t.Fatalf("clone root: got %v, want %v", branch.Root(), origRoot)
+	}
+	for i := int64(6); i < 10; i++ {
+		if err := branch.Add(ctx, big.NewInt(i), big.NewInt(i*10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := branch.Update(ctx, big.NewInt(0), big.NewInt(42)); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh := NewMerkleRedisStorageUniversal(s.db, "orig")
+	root, err := fresh.GetRoot(ctx)
+	if err != nil || *root != origRoot {
+		t.Fatalf("original root: got %v, %v, want %v", root, err, origRoot)
+	}
+	if n, err := fresh.NodeCount(ctx); err != nil || n != origNodes {
+		t.Fatalf("original node count: got %d, %v, want %d", n, err, origNodes)
+	}
+	mt, err := merkletree.NewMerkleTree(ctx, fresh, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, v, _, err := mt.Get(ctx, big.NewInt(0))
+	if err != nil || v.Int64() != 0 {
+		t.Fatalf("original entry 0: got %v, %v, want 0", v, err)
+	}
+	if _, _, _, err := mt.Get(ctx, big.NewInt(7)); !errors.Is(err, merkletree.ErrKeyNotFound) {
+		t.Fatalf("entry added to the clone: got %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestCloneEmpty(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStorage(t, "empty")
+	c, err := s.Clone(ctx, "empty_clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetRoot(ctx); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,83 @@
+package merkleredis
+
+import "encoding/binary"
+
+// nodeFormatVersionCompact is the version MarshalNodeItemCompact writes.
+const nodeFormatVersionCompact byte = 3
+
+// WithCompactNodes writes nodes in the compact format of
+// MarshalNodeItemCompact, which saves 11 bytes on a typical node. Stores read
+// both formats whatever this option, but releases predating the compact format
+// can't read nodes written with it.
+func WithCompactNodes() Option {
+	return func(s *Storage) {
+		s.compactNodes = true
+	}
+}
+
+// MarshalNodeItemCompact serializes a node like MarshalNodeItem, in version 3
+// of the format: a version byte of 0x83, then the type byte, then the lengths
+// of Key, ChildL, ChildR, Entry and Meta as unsigned varints, as written by
+// binary.PutUvarint, then the five fields in that order. Nodes of 32 byte
+// hashes have lengths that fit in one byte each.
+func MarshalNodeItemCompact(n *NodeItem) ([]byte, error) {
+	fields := [][]byte{n.Key, n.ChildL, n.ChildR, n.Entry, n.Meta}
+	total := 2
+	for _, f := range fields {
+		total += len(f) + uvarintLen(uint64(len(f)))
+	}
+	b := make([]byte, 2, total)
+	b[0] = nodeFormatFlag | nodeFormatVersionCompact
+	b[1] = n.Type
+	for _, f := range fields {
+		b = binary.AppendUvarint(b, uint64(len(f)))
+	}
+	for _, f := range fields {
+		b = append(b, f...)
+	}
+	return b, nil
+}
+
+// unmarshalNodeItemCompact decodes the body of version 3, which follows the
+// version byte.
+func unmarshalNodeItemCompact(d []byte) (*NodeItem, error) {
+	if len(d) == 0 {
+		return nil, newErr(ErrCorruptNode, "invalid header")
+	}
+	ni := &NodeItem{Type: d[0]}
+	p := 1
+	var lens [5]uint64
+	for i := range lens {
+		n, size := binary.Uvarint(d[p:])
+		if size <= 0 {
+			return nil, newErr(ErrCorruptNode, "invalid header")
+		}
+		lens[i] = n
+		p += size
+	}
+	fields := []*[]byte{&ni.Key, &ni.ChildL, &ni.ChildR, &ni.Entry, &ni.Meta}
+	for i, f := range fields {
+		if lens[i] > uint64(len(d)-p) {
+			return nil, newErr(ErrCorruptNode, "overflow")
+		}
+		end := p + int(lens[i])
+		*f = d[p:end]
+		p = end
+	}
+	if p != len(d) {
+		return nil, newErr(ErrCorruptNode, "trailing bytes")
+	}
+	if len(ni.Meta) == 0 {
+		ni.Meta = nil
+	}
+	return ni, nil
+}
+
+func uvarintLen(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
@@ -0,0 +1,104 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestMarshalNodeItemCompact(t *testing.T) {
+	entry := append(append([]byte(nil), testHash(2)[:]...), testHash(3)[:]...)
+	for _, item := range []*NodeItem{
+		{Type: byte(merkletree.NodeTypeLeaf), Key: testHash(1)[:], Entry: entry},
+		{Type: byte(merkletree.NodeTypeMiddle), Key: testHash(1)[:], ChildL: testHash(4)[:], ChildR: testHash(5)[:]},
+		{Type: byte(merkletree.NodeTypeEmpty)},
+		{Type: byte(merkletree.NodeTypeLeaf), Key: []byte("k"), Entry: entry, Meta: []byte("source=a")},
+		// lengths of several varint bytes
+		{Type: 7, Key: bytes.Repeat([]byte{1}, 300), Entry: bytes.Repeat([]byte{2}, 70000)},
+	} {
+		d, err := MarshalNodeItemCompact(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d[0] != 0x83 {
+			t.Fatalf("version byte %#x", d[0])
+		}
+		got, err := UnmarshalNodeItem(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Type != item.Type || !bytes.Equal(got.Key, item.Key) || !bytes.Equal(got.ChildL, item.ChildL) ||
+			!bytes.Equal(got.ChildR, item.ChildR) || !bytes.Equal(got.Entry, item.Entry) || !bytes.Equal(got.Meta, item.Meta) {
+			t.Fatalf("got %+v, want %+v", got, item)
+		}
+		if len(item.Meta) == 0 && got.Meta != nil {
+			t.Fatalf("Meta: got %q, want nil", got.Meta)
+		}
+	}
+
+	leaf, _ := MarshalNodeItemCompact(&NodeItem{Type: 1, Key: []byte{9}, Entry: []byte{4, 4}})
+	if want := []byte{0x83, 1, 1, 0, 0, 2, 0, 9, 4, 4}; !bytes.Equal(leaf, want) {
+		t.Fatalf("got %x, want %x", leaf, want)
+	}
+	for _, d := range [][]byte{
+		{0x83},
+		{0x83, 1, 1, 0, 0},
+		{0x83, 1, 1, 0, 0, 3, 0, 9, 4, 4},
+		{0x83, 1, 1, 0, 0, 2, 0, 9, 4, 4, 0},
+		{0x83, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	} {
+		if _, err := UnmarshalNodeItem(d); !errors.Is(err, ErrCorruptNode) {
+			t.Fatalf("%x: got %v, want ErrCorruptNode", d, err)
+		}
+	}
+}
+
+func TestCompactNodeSize(t *testing.T) {
+	entry := append(append([]byte(nil), testHash(2)[:]...), testHash(3)[:]...)
+	for _, item := range []*NodeItem{
+		{Type: byte(merkletree.NodeTypeLeaf), Key: testHash(1)[:], Entry: entry},
+		{Type: byte(merkletree.NodeTypeMiddle), Key: testHash(1)[:], ChildL: testHash(4)[:], ChildR: testHash(5)[:]},
+	} {
+		legacy, err := MarshalNodeItem(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compact, err := MarshalNodeItemCompact(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// four 4-byte lengths become five 1-byte ones
+		if saved := len(legacy) - len(compact); saved != 11 {
+			t.Fatalf("type %d: legacy %d bytes, compact %d", item.Type, len(legacy), len(compact))
+		}
+	}
+}
+
+func TestCompactNodes(t *testing.T) {
+	ctx := context.Background()
+	legacy, srv := newTestStorage(t, "compact")
+	tree := newTestTree(t, legacy, 8)
+
+	s := NewMerkleRedisStorage(srv.Client(t), "compact", WithCompactNodes())
+	kvs := testLeafKVs(20)[10:]
+	if err := s.PutBatch(ctx, kvs); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := srv.Raw(s.getRedisNodeIdForMerkleKey(kvs[0].K))
+	if raw[0] != 0x83 {
+		t.Fatalf("stored version byte %#x", raw[0])
+	}
+	// both formats are read by either store
+	for _, store := range []*Storage{s, legacy} {
+		if _, err := store.Get(ctx, kvs[0].K); err != nil {
+			t.Fatal(err)
+		}
+		if problems, err := store.VerifyIntegrity(ctx); err != nil || len(problems) != 0 {
+			t.Fatalf("VerifyIntegrity: %v, %v", problems, err)
+		}
+	}
+	checkRoot(t, s, tree.Root())
+}
@@ -0,0 +1,125 @@
+package merkleredis
+
+import (
+	"compress/gzip"
+	"fmt"
+	"sync"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/gzipcompressor"
+)
+
+// Compressor compresses serialized node values before they are written to
+// Redis, see WithCompression.
+type Compressor interface {
+	Compress([]byte) ([]byte, error)
+	Decompress([]byte) ([]byte, error)
+}
+
+// compressedTag prefixes node values written through a Compressor. Plain
+// serialized nodes start with their format version or type byte, which are
+// always lower, so values written without compression stay readable.
+const compressedTag byte = 0xc0
+
+// Codec tags identify how a node value was compressed, so any store can
+// decode it whatever its own write codec, see WithCodec. No zstd or snappy
+// Compressor is shipped with this module; their tags are reserved for
+// implementations registered with RegisterCompressor.
+const (
+	CodecGzip   byte = 0xc1
+	CodecZstd   byte = 0xc2
+	CodecSnappy byte = 0xc3
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[byte]Compressor{
+		CodecGzip: gzipcompressor.New(gzip.DefaultCompression),
+	}
+)
+
+// RegisterCompressor makes every store decode values tagged with tag using c,
+// replacing any Compressor registered for tag before. Tags must be above 0xc0,
+// which marks values written with WithCompression. CodecGzip is registered by
+// default.
+func RegisterCompressor(tag byte, c Compressor) {
+	if tag <= compressedTag {
+		panic(fmt.Sprintf("merkleredis: codec tag %#x is not above %#x", tag, compressedTag))
+	}
+	if c == nil {
+		panic("merkleredis: nil Compressor")
+	}
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[tag] = c
+}
+
+func registeredCompressor(tag byte) Compressor {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	return codecs[tag]
+}
+
+// WithCodec compresses node values with c, or with the Compressor registered
+// for tag if c is nil, and tags them with tag. Any store can read them as long
+// as a Compressor is registered for tag, so the write codec can be changed
+// without rewriting existing data. Passing c tunes the write side, for example
+// WithCodec(CodecGzip, gzipcompressor.New(gzip.BestCompression)).
+func WithCodec(tag byte, c Compressor) Option {
+	return func(s *Storage) {
+		s.codecTag = tag
+		s.codec = c
+	}
+}
+
+// WithCompression compresses node values with c. Values stored without
+// compression can still be read, and compressed values can only be read by a
+// store configured with the same Compressor.
+func WithCompression(c Compressor) Option {
+	return func(s *Storage) {
+		s.compressor = c
+	}
+}
+
+func (s *Storage) compress(d []byte) ([]byte, error) {
+	tag, c := s.codecTag, s.codec
+	switch {
+	case tag != 0 && c == nil:
+		if c = registeredCompressor(tag); c == nil {
+			return nil, fmt.Errorf("no compressor registered for codec %#x", tag)
+		}
+	case tag == 0 && s.compressor != nil:
+		tag, c = compressedTag, s.compressor
+	case tag == 0:
+		return d, nil
+	}
+	out, err := c.Compress(d)
+	if err != nil {
+		return nil, newErr(err, "failed to compress node")
+	}
+	return append([]byte{tag}, out...), nil
+}
+
+func (s *Storage) decompress(d []byte) ([]byte, error) {
+	if len(d) == 0 || d[0] < compressedTag {
+		return d, nil
+	}
+	var c Compressor
+	switch tag := d[0]; {
+	case tag == compressedTag:
+		if s.compressor == nil {
+			return nil, newErr(ErrCorruptNode, "compressed node but no compressor configured")
+		}
+		c = s.compressor
+	case tag == s.codecTag && s.codec != nil:
+		c = s.codec
+	default:
+		if c = registeredCompressor(tag); c == nil {
+			return nil, newErr(ErrCorruptNode, fmt.Sprintf("no compressor registered for codec %#x", tag))
+		}
+	}
+	out, err := c.Decompress(d[1:])
+	if err != nil {
+		return nil, newErr(ErrCorruptNode, "failed to decompress node: "+err.Error())
+	}
+	return out, nil
+}
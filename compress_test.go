@@ -0,0 +1,138 @@
+package merkleredis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/gzipcompressor"
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	plain := NewMerkleRedisStorage(srv.Client(t), "gz")
+	s := NewMerkleRedisStorage(srv.Client(t), "gz", WithCompression(gzipcompressor.New(gzip.DefaultCompression)))
+
+	// written before compression was enabled
+	old := merkletree.NewNodeLeaf(testHash(1), testHash(2))
+	if err := plain.Put(ctx, []byte("old"), old); err != nil {
+		t.Fatal(err)
+	}
+	node := merkletree.NewNodeMiddle(testHash(3), testHash(4))
+	if err := s.Put(ctx, []byte("new"), node); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := srv.Raw(s.getRedisNodeIdForMerkleKey([]byte("new")))
+	if len(raw) == 0 || raw[0] != compressedTag {
+		t.Fatalf("value not tagged as compressed: %x", raw)
+	}
+	got, err := s.Get(ctx, []byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != node.Type || *got.ChildL != *node.ChildL || *got.ChildR != *node.ChildR {
+		t.Fatalf("got %+v, want %+v", got, node)
+	}
+	got, err = s.Get(ctx, []byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != old.Type || *got.Entry[0] != *old.Entry[0] {
+		t.Fatalf("got %+v, want %+v", got, old)
+	}
+}
+
+// xorCompressor is a stand-in codec that flips every byte.
+type xorCompressor struct{}
+
+func (xorCompressor) Compress(d []byte) ([]byte, error) {
+	out := make([]byte, len(d))
+	for i, b := range d {
+		out[i] = b ^ 0xff
+	}
+	return out, nil
+}
+
+func (c xorCompressor) Decompress(d []byte) ([]byte, error) {
+	return c.Compress(d)
+}
+
+func TestCodecRegistry(t *testing.T) {
+	const codecXor byte = 0xd0
+	RegisterCompressor(codecXor, xorCompressor{})
+
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	xor := NewMerkleRedisStorage(srv.Client(t), "codec", WithCodec(codecXor, nil))
+	node := merkletree.NewNodeLeaf(testHash(1), testHash(2))
+	if err := xor.Put(ctx, []byte("xor"), node); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := srv.Raw(xor.getRedisNodeIdForMerkleKey([]byte("xor")))
+	if len(raw) == 0 || raw[0] != codecXor {
+		t.Fatalf("value not tagged with the codec: %x", raw)
+	}
+
+	// the store switches to gzip, and can still read what it wrote with xor
+	gz := NewMerkleRedisStorage(srv.Client(t), "codec",
+		WithCodec(CodecGzip, gzipcompressor.New(gzip.BestCompression)))
+	if err := gz.Put(ctx, []byte("gzip"), node); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ = srv.Raw(gz.getRedisNodeIdForMerkleKey([]byte("gzip")))
+	if len(raw) == 0 || raw[0] != CodecGzip {
+		t.Fatalf("value not tagged with gzip: %x", raw)
+	}
+	plain := NewMerkleRedisStorage(srv.Client(t), "codec")
+	for _, s := range []*Storage{gz, plain} {
+		for _, k := range []string{"xor", "gzip"} {
+			got, err := s.Get(ctx, []byte(k))
+			if err != nil {
+				t.Fatalf("%s: %v", k, err)
+			}
+			if *got.Entry[1] != *node.Entry[1] {
+				t.Fatalf("%s: got %+v, want %+v", k, got, node)
+			}
+		}
+	}
+
+	srv.SetRaw(plain.getRedisNodeIdForMerkleKey([]byte("unknown")), append([]byte{0xfe}, raw[1:]...))
+	if _, err := plain.Get(ctx, []byte("unknown")); !errors.Is(err, ErrCorruptNode) {
+		t.Fatalf("unregistered codec: got %v, want ErrCorruptNode", err)
+	}
+}
+
+func BenchmarkCompression64KBEntries(b *testing.B) {
+	item := &NodeItem{
+		Type:  byte(merkletree.NodeTypeLeaf),
+		Key:   testHash(1)[:],
+		Entry: bytes.Repeat([]byte("leaf data "), 64*1024/10),
+	}
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"none", nil},
+		{"gzip", []Option{WithCompression(gzipcompressor.New(gzip.DefaultCompression))}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			s := NewMerkleRedisStorage(nil, "bench", bc.opts...)
+			var size int
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				v, err := s.encodeNodeItem(item)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(v.([]byte))
+			}
+			b.ReportMetric(float64(size), "stored-B/node")
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package merkleredis
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// nodeCountSuffix is appended to the root key to form the node counter key.
+const nodeCountSuffix = "_count"
+
+// NodeCount returns the number of nodes stored for the tree.
+//
+// Without WithNodeCounter the nodes are counted with SCAN on every call. With
+// it the count is read from a counter key that Put, PutBatch and Delete update
+// after each write, and that is rebuilt with a scan when missing. The counter is
+// only eventually consistent: it is updated in a separate round-trip from the
+// write, so a failure in between or a concurrent RebuildNodeCount can leave it
+// off, and it doesn't track nodes written by CommitRoot or expired by a TTL.
+// Call RebuildNodeCount to resynchronise it.
+func (s *Storage) NodeCount(ctx context.Context) (int64, error) {
+	if !s.nodeCounter {
+		return s.scanNodeCount(ctx)
+	}
+
+	n, err := s.readNodeCount(ctx)
+	if err == redis.Nil {
+		return s.RebuildNodeCount(ctx)
+	}
+	return n, err
+}
+
+// RebuildNodeCount counts the nodes of the tree with SCAN, leaving out those of
+// trees derived from it with WithPrefix, and stores the result in the node
+// counter key. Writes made while it runs may not be reflected.
+func (s *Storage) RebuildNodeCount(ctx context.Context) (int64, error) {
+	n, err := s.scanNodeCount(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if err := s.db.Set(ctx, s.rootId+nodeCountSuffix, n, 0).Err(); err != nil {
+		return 0, newErr(err, "failed to store node count")
+	}
+	return n, nil
+}
+
+func (s *Storage) readNodeCount(ctx context.Context) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	v, err := s.db.Get(ctx, s.rootId+nodeCountSuffix).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, err
+		}
+		return 0, newErr(err, "failed to read node count")
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, newErr(err, "invalid node count")
+	}
+	return n, nil
+}
+
+func (s *Storage) scanNodeCount(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.scanNodeKeys(ctx, func(keys []string) error {
+		n += int64(len(keys))
+		return nil
+	})
+	return n, err
+}
+
+// putCounted writes a node and increments the node counter if the node didn't
+// exist before.
+func (s *Storage) putCounted(ctx context.Context, id string, v interface{}) error {
+	err := s.db.SetArgs(ctx, id, v, redis.SetArgs{TTL: s.ttl, Get: true}).Err()
+	if err == nil {
+		return nil
+	}
+	if err != redis.Nil {
+		return err
+	}
+	return s.db.Incr(ctx, s.rootId+nodeCountSuffix).Err()
+}
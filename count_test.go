@@ -0,0 +1,129 @@
+package merkleredis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+)
+
+func TestNodeCountIncremental(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "count", WithNodeCounter())
+
+	checkCount := func(want int64) {
+		t.Helper()
+		n, err := s.NodeCount(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Fatalf("NodeCount = %d, want %d", n, want)
+		}
+	}
+
+	kvs := testLeafKVs(10)
+	for _, kv := range kvs[:3] {
+		if err := s.Put(ctx, kv.K, &kv.V); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkCount(3)
+	// overwriting a node doesn't change the count
+	if err := s.Put(ctx, kvs[0].K, &kvs[0].V); err != nil {
+		t.Fatal(err)
+	}
+	checkCount(3)
+	if err := s.PutBatch(ctx, kvs[1:]); err != nil {
+		t.Fatal(err)
+	}
+	checkCount(10)
+	if err := s.Delete(ctx, kvs[4].K); err != nil {
+		t.Fatal(err)
+	}
+	checkCount(9)
+
+	// the counter is read, not rebuilt
+	scans := srv.Count("SCAN")
+	checkCount(9)
+	if n := srv.Count("SCAN"); n != scans {
+		t.Fatalf("NodeCount scanned the keyspace %d times", n-scans)
+	}
+
+	if err := s.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	checkCount(0)
+}
+
+func TestNodeCountRebuild(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	plain := NewMerkleRedisStorage(srv.Client(t), "rebuild")
+	counted := NewMerkleRedisStorage(srv.Client(t), "rebuild", WithNodeCounter())
+
+	// nodes written without the counter are found by the fallback scan
+	kvs := testLeafKVs(150)
+	if err := plain.PutBatch(ctx, kvs); err != nil {
+		t.Fatal(err)
+	}
+	n, err := plain.NodeCount(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(kvs)) {
+		t.Fatalf("scanned NodeCount = %d, want %d", n, len(kvs))
+	}
+	if n, err = counted.NodeCount(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(kvs)) {
+		t.Fatalf("rebuilt NodeCount = %d, want %d", n, len(kvs))
+	}
+
+	// drift from writes bypassing the counter is fixed by a rebuild
+	if err := plain.Delete(ctx, kvs[0].K); err != nil {
+		t.Fatal(err)
+	}
+	if n, err = counted.NodeCount(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(kvs)) {
+		t.Fatalf("stale NodeCount = %d, want %d", n, len(kvs))
+	}
+	if n, err = counted.RebuildNodeCount(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(kvs)-1) {
+		t.Fatalf("RebuildNodeCount = %d, want %d", n, len(kvs)-1)
+	}
+}
+
+func TestNodeCountSkipsDerivedTrees(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	counted := NewMerkleRedisStorage(srv.Client(t), "count", WithNodeCounter())
+	scanned := NewMerkleRedisStorage(srv.Client(t), "count")
+	kvs := testLeafKVs(5)
+	if err := scanned.PutBatch(ctx, kvs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := scanned.WithPrefix("child").PutBatch(ctx, kvs[2:]); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := scanned.NodeCount(ctx); err != nil || n != 2 {
+		t.Fatalf("NodeCount: got %d, %v, want 2", n, err)
+	}
+	if n, err := counted.RebuildNodeCount(ctx); err != nil || n != 2 {
+		t.Fatalf("RebuildNodeCount: got %d, %v, want 2", n, err)
+	}
+	stats, err := scanned.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NodeCount != 2 {
+		t.Fatalf("Stats.NodeCount: got %d, want 2", stats.NodeCount)
+	}
+}
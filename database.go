@@ -0,0 +1,60 @@
+package merkleredis
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// ErrDatabaseUnsupported is returned by NewMerkleRedisStorageChecked for
+// WithDatabase along with a client that can't select a database, such as a
+// cluster client.
+var ErrDatabaseUnsupported = errors.New("client can't select a database")
+
+// scopeDatabase replaces the clients of s with clients of the same servers
+// that select s.database, see WithDatabase. A client that isn't a
+// *redis.Client is kept as is, with a warning.
+func (s *Storage) scopeDatabase() {
+	s.db = s.databaseClient(s.db)
+	if s.readDb != nil {
+		s.readDb = s.databaseClient(s.readDb)
+	}
+	if s.secondary != nil {
+		s.secondary = s.databaseClient(s.secondary)
+	}
+}
+
+// databaseClient returns a client selecting s.database on the server of
+// client, which Close closes, or client itself if it can't select one.
+func (s *Storage) databaseClient(client redis.UniversalClient) redis.UniversalClient {
+	c, ok := client.(*redis.Client)
+	if !ok {
+		s.warnf("WithDatabase ignored for %T, which can't select a database", client)
+		return client
+	}
+	opt := *c.Options()
+	opt.DB = s.database
+	scoped := redis.NewClient(&opt)
+	s.closeClients = append(s.closeClients, scoped)
+	return scoped
+}
+
+// checkDatabase returns an error wrapping ErrDatabaseUnsupported if opts set
+// WithDatabase along with a read or secondary client that can't select a
+// database.
+func checkDatabase(opts []Option) error {
+	var configured Storage
+	for _, opt := range opts {
+		opt(&configured)
+	}
+	if !configured.selectDatabase {
+		return nil
+	}
+	for _, c := range []redis.UniversalClient{configured.readDb, configured.secondary} {
+		if _, ok := c.(*redis.Client); c != nil && !ok {
+			return newErr(ErrDatabaseUnsupported, fmt.Sprintf("WithDatabase with %T", c))
+		}
+	}
+	return nil
+}
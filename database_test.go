@@ -0,0 +1,84 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestWithDatabase(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	client := srv.Client(t)
+	a := NewMerkleRedisStorage(client, "db", WithDatabase(1))
+	defer a.Close()
+	b := NewMerkleRedisStorage(client, "db", WithDatabase(2))
+	defer b.Close()
+
+	key := []byte("k")
+	if err := a.Put(ctx, key, merkletree.NewNodeLeaf(testHash(1), testHash(2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetRoot(ctx, testHash(3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get(ctx, key); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("Get on another database: got %v, want ErrNotFound", err)
+	}
+	if _, err := b.GetRoot(ctx); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("GetRoot on another database: got %v, want ErrNotFound", err)
+	}
+	// the node, the root, its timestamp, the format version and the tree
+	// version
+	if n := len(srv.KeysIn(1)); n != 5 {
+		t.Fatalf("database 1 holds %d keys, want 5", n)
+	}
+	if n := len(srv.Keys()); n != 0 {
+		t.Fatalf("database 0 holds %d keys, want 0", n)
+	}
+
+	// the store's own client is closed, the given one is not
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Fatalf("given client was closed: %v", err)
+	}
+}
+
+func TestWithDatabaseCluster(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+
+	// the unchecked constructor keeps the cluster client
+	s := NewMerkleRedisStorageUniversal(srv.ClusterClient(t), "db", WithDatabase(1))
+	if _, ok := s.db.(*redis.ClusterClient); !ok {
+		t.Fatalf("got a %T, want the cluster client", s.db)
+	}
+	_, err := NewMerkleRedisStorageChecked(ctx, srv.Client(t), "db",
+		WithDatabase(1), WithReadClient(srv.ClusterClient(t)))
+	if !errors.Is(err, ErrDatabaseUnsupported) {
+		t.Fatalf("got %v, want ErrDatabaseUnsupported", err)
+	}
+}
+
+func TestWithDatabaseFailover(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := fakeredis.New(t), fakeredis.New(t)
+	s := NewMerkleRedisStorage(primary.Client(t), "db", WithDatabase(1), WithFailover(secondary.Client(t)))
+	defer s.Close()
+
+	if err := s.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(secondary.KeysIn(1)); n == 0 {
+		t.Fatal("no mirrored keys in database 1 of the secondary")
+	}
+	if n := len(secondary.Keys()); n != 0 {
+		t.Fatalf("database 0 of the secondary holds %d keys, want 0", n)
+	}
+}
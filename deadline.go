@@ -0,0 +1,138 @@
+package merkleredis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// WithPerKeyDeadline splits the pipelines of PutBatch and HasMulti into
+// segments, one per Redis Cluster shard owning some of their keys, run
+// concurrently and each bounded by d, so a slow shard only fails its own keys
+// instead of the whole batch. When some segments fail, the operation returns a
+// *PartialError telling which keys succeeded. Without a cluster client the
+// single pipeline is bounded by d. d <= 0, the default, sets no bound.
+// As with WithOperationTimeout, go-redis only interrupts a pipeline in flight
+// when the client is created with ContextTimeoutEnabled.
+func WithPerKeyDeadline(d time.Duration) Option {
+	return func(s *Storage) {
+		s.perKeyDeadline = d
+	}
+}
+
+// PartialError is returned by multi-key operations that succeeded for some of
+// their keys only, see WithPerKeyDeadline.
+type PartialError struct {
+	// Succeeded holds the keys the operation completed for, and Failed the
+	// others, both in the order they were given.
+	Succeeded [][]byte
+	Failed    [][]byte
+	// Err is the error of the first failed segment.
+	Err error
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("%d of %d keys failed: %v", len(e.Failed), len(e.Failed)+len(e.Succeeded), e.Err)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// newPartialError returns the PartialError for keys of which those at the
+// indexes in failed, in increasing order, failed with err.
+func newPartialError(keys [][]byte, failed []int, err error) *PartialError {
+	e := &PartialError{Err: err}
+	for i, key := range keys {
+		if len(failed) > 0 && failed[0] == i {
+			e.Failed = append(e.Failed, key)
+			failed = failed[1:]
+		} else {
+			e.Succeeded = append(e.Succeeded, key)
+		}
+	}
+	return e
+}
+
+// runSegments runs fn over the indexes of ids, the key names a multi-key
+// operation accesses through client. Without WithPerKeyDeadline it runs fn
+// once over all of them and returns its error. Otherwise it runs fn
+// concurrently for the indexes of each segment, with a context bounded by the
+// deadline, and returns the indexes of the segments that failed, in increasing
+// order, with the first error.
+func (s *Storage) runSegments(ctx context.Context, client redis.UniversalClient, ids []string,
+	fn func(ctx context.Context, idx []int) error) ([]int, error) {
+
+	all := make([]int, len(ids))
+	for i := range ids {
+		all[i] = i
+	}
+	if s.perKeyDeadline <= 0 {
+		return nil, fn(ctx, all)
+	}
+	segments := [][]int{all}
+	if cluster, ok := client.(*redis.ClusterClient); ok {
+		var err error
+		if segments, err = clusterSegments(ctx, cluster, ids); err != nil {
+			return nil, err
+		}
+	}
+
+	errs := make([]error, len(segments))
+	var wg sync.WaitGroup
+	for i, idx := range segments {
+		wg.Add(1)
+		go func(i int, idx []int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, s.perKeyDeadline)
+			defer cancel()
+			errs[i] = fn(ctx, idx)
+		}(i, idx)
+	}
+	wg.Wait()
+
+	failedSet := map[int]bool{}
+	var firstErr error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		for _, j := range segments[i] {
+			failedSet[j] = true
+		}
+	}
+	var failed []int
+	for i := range ids {
+		if failedSet[i] {
+			failed = append(failed, i)
+		}
+	}
+	return failed, firstErr
+}
+
+// clusterSegments groups the indexes of ids by the cluster shard owning them.
+func clusterSegments(ctx context.Context, cluster *redis.ClusterClient, ids []string) ([][]int, error) {
+	shards := map[string]int{}
+	var segments [][]int
+	for i, id := range ids {
+		master, err := cluster.MasterForKey(ctx, id)
+		if err != nil {
+			return nil, newErr(err, "failed to look up cluster shard")
+		}
+		addr := master.Options().Addr
+		j, ok := shards[addr]
+		if !ok {
+			j = len(segments)
+			shards[addr] = j
+			segments = append(segments, nil)
+		}
+		segments[j] = append(segments[j], i)
+	}
+	return segments, nil
+}
@@ -0,0 +1,103 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/go-redis/redis/v9"
+)
+
+func TestPerKeyDeadline(t *testing.T) {
+	ctx := context.Background()
+	shards := fakeredis.NewCluster(t, 2)
+	client := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:                 []string{shards[0].Addr(), shards[1].Addr()},
+		ContextTimeoutEnabled: true,
+	})
+	defer client.Close()
+	s := NewMerkleRedisStorageUniversal(client, "deadline", WithPerKeyDeadline(50*time.Millisecond))
+
+	kvs := testLeafKVs(16)
+	// the second shard owns the upper half of the slots
+	var fast, slow [][]byte
+	for _, kv := range kvs {
+		if fakeredis.KeySlot(s.getRedisNodeIdForMerkleKey(kv.K)) < 8192 {
+			fast = append(fast, kv.K)
+		} else {
+			slow = append(slow, kv.K)
+		}
+	}
+	if len(fast) == 0 || len(slow) == 0 {
+		t.Fatalf("keys don't span both shards: %d and %d", len(fast), len(slow))
+	}
+
+	shards[1].SetLatency(200 * time.Millisecond)
+	err := s.PutBatch(ctx, kvs)
+	var partial *PartialError
+	if !errors.As(err, &partial) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("PutBatch: got %v, want a PartialError wrapping DeadlineExceeded", err)
+	}
+	checkKeys := func(name string, got, want [][]byte) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %d keys, want %d", name, len(got), len(want))
+		}
+		for i := range got {
+			if !bytes.Equal(got[i], want[i]) {
+				t.Fatalf("%s[%d]: got %x, want %x", name, i, got[i], want[i])
+			}
+		}
+	}
+	checkKeys("Succeeded", partial.Succeeded, fast)
+	checkKeys("Failed", partial.Failed, slow)
+
+	found, err := s.HasMulti(ctx, keysOf(kvs))
+	if !errors.As(err, &partial) {
+		t.Fatalf("HasMulti: got %v, want a PartialError", err)
+	}
+	checkKeys("HasMulti Succeeded", partial.Succeeded, fast)
+	for i, kv := range kvs {
+		if isFast := fakeredis.KeySlot(s.getRedisNodeIdForMerkleKey(kv.K)) < 8192; found[i] != isFast {
+			t.Fatalf("HasMulti[%d] = %v", i, found[i])
+		}
+	}
+
+	// once the shard recovers the whole batch goes through
+	shards[1].SetLatency(0)
+	if err := s.PutBatch(ctx, kvs); err != nil {
+		t.Fatal(err)
+	}
+	found, err = s.HasMulti(ctx, keysOf(kvs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ok := range found {
+		if !ok {
+			t.Fatalf("HasMulti[%d] = false", i)
+		}
+	}
+}
+
+func TestPerKeyDeadlineStandalone(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr(), ContextTimeoutEnabled: true})
+	defer client.Close()
+	s := NewMerkleRedisStorage(client, "deadline", WithPerKeyDeadline(50*time.Millisecond))
+	kvs := testLeafKVs(4)
+	if err := s.PutBatch(ctx, kvs); err != nil {
+		t.Fatal(err)
+	}
+
+	// without a cluster the single pipeline is the only segment
+	srv.SetLatency(100 * time.Millisecond)
+	_, err := s.HasMulti(ctx, keysOf(kvs))
+	var partial *PartialError
+	if !errors.As(err, &partial) || len(partial.Succeeded) != 0 || len(partial.Failed) != len(kvs) {
+		t.Fatalf("HasMulti: got %v, want a PartialError failing every key", err)
+	}
+}
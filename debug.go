@@ -0,0 +1,87 @@
+package merkleredis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// debugDumpMaxNodes is the number of nodes DebugDump lists at most.
+const debugDumpMaxNodes = 1000
+
+// String identifies the store by its prefix and root key, for logging. It
+// leaves out the client, whose options may hold credentials.
+func (s *Storage) String() string {
+	return fmt.Sprintf("merkleredis.Storage{prefix: %q, root key: %q}", s.prefix, s.rootId)
+}
+
+// DebugDump writes a human-readable listing of the root and the nodes of the
+// tree to w, one per line and sorted by key, for inspecting small trees while
+// debugging. Only the first debugDumpMaxNodes nodes found by SCAN are listed,
+// followed by a line saying the listing was cut short.
+func (s *Storage) DebugDump(ctx context.Context, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, s.String())
+	root, err := s.GetRoot(ctx)
+	switch {
+	case err == nil:
+		fmt.Fprintf(bw, "root %x\n", root[:])
+	case errors.Is(err, merkletree.ErrNotFound):
+		fmt.Fprintln(bw, "no root")
+	default:
+		return err
+	}
+
+	var items []*NodeItem
+	truncated := false
+	err = s.scanNodes(ctx, func(item *NodeItem) error {
+		if len(items) == debugDumpMaxNodes {
+			truncated = true
+			return errStopScan
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return bytes.Compare(items[i].Key, items[j].Key) < 0
+	})
+	for _, item := range items {
+		fmt.Fprintf(bw, "%x %s", item.Key, nodeTypeName(item.Type))
+		if len(item.ChildL) > 0 || len(item.ChildR) > 0 {
+			fmt.Fprintf(bw, " left %x right %x", item.ChildL, item.ChildR)
+		}
+		if len(item.Entry) > 0 {
+			fmt.Fprintf(bw, " entry %x", item.Entry)
+		}
+		if len(item.Meta) > 0 {
+			fmt.Fprintf(bw, " meta %q", item.Meta)
+		}
+		fmt.Fprintln(bw)
+	}
+	if truncated {
+		fmt.Fprintf(bw, "more nodes not shown, the dump stops at %d\n", debugDumpMaxNodes)
+	}
+	return bw.Flush()
+}
+
+func nodeTypeName(typ byte) string {
+	switch merkletree.NodeType(typ) {
+	case merkletree.NodeTypeMiddle:
+		return "middle"
+	case merkletree.NodeTypeLeaf:
+		return "leaf"
+	case merkletree.NodeTypeEmpty:
+		return "empty"
+	default:
+		return fmt.Sprintf("type %d", typ)
+	}
+}
@@ -0,0 +1,64 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	s, _ := newTestStorage(t, "logged")
+	for _, v := range []string{s.String(), fmt.Sprint(s), fmt.Sprintf("%v", s)} {
+		if !strings.Contains(v, `"logged"`) || !strings.Contains(v, s.rootId) {
+			t.Fatalf("got %q, want the prefix and root key", v)
+		}
+	}
+}
+
+func TestDebugDump(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStorage(t, "dump")
+
+	var buf bytes.Buffer
+	if err := s.DebugDump(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 || lines[1] != "no root" {
+		t.Fatalf("empty tree: got %q", buf.String())
+	}
+
+	tree := newTestTree(t, s, 4)
+	n, err := s.NodeCount(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := s.DebugDump(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if want := fmt.Sprintf("root %x", tree.Root()[:]); lines[1] != want {
+		t.Fatalf("got %q, want %q", lines[1], want)
+	}
+	if len(lines) != 2+int(n) {
+		t.Fatalf("got %d lines for %d nodes:\n%s", len(lines), n, buf.String())
+	}
+	if !strings.Contains(buf.String(), " leaf entry ") || !strings.Contains(buf.String(), " middle left ") {
+		t.Fatalf("missing leaf or middle node:\n%s", buf.String())
+	}
+
+	big, _ := newTestStorage(t, "dumpbig")
+	if err := big.PutBatch(ctx, testLeafKVs(debugDumpMaxNodes+5)); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := big.DebugDump(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2+debugDumpMaxNodes+1 || !strings.HasPrefix(lines[len(lines)-1], "more nodes not shown") {
+		t.Fatalf("got %d lines, last %q", len(lines), lines[len(lines)-1])
+	}
+}
@@ -0,0 +1,66 @@
+package merkleredis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// checkEntry returns an error wrapping merkletree.ErrNodeBytesBadSize if entry
+// isn't a standard two element entry and WithExtendedEntries isn't set.
+func (s *Storage) checkEntry(entry []byte) error {
+	if s.extendedEntries || len(entry) == entryLen {
+		return nil
+	}
+	return newErr(merkletree.ErrNodeBytesBadSize, fmt.Sprintf("leaf entry is %d bytes, want %d", len(entry), entryLen))
+}
+
+// PutEntry stores a leaf node holding entry under key. The entry must be two
+// elements long unless WithExtendedEntries is set, in which case it may be of
+// any length and is read back with GetEntry. The entry is stored as is; the
+// caller computes key, as the hashing of extended entries is up to the fork
+// using them.
+func (s *Storage) PutEntry(ctx context.Context, key, entry []byte) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	if err := s.checkEntry(entry); err != nil {
+		return err
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	item := &NodeItem{Type: byte(merkletree.NodeTypeLeaf), Key: key, Entry: entry}
+	v, err := s.encodeNodeItem(item)
+	if err != nil {
+		return err
+	}
+	// the node cache may hold a node previously stored under key
+	s.nodeCache.remove(key)
+	return s.retry(ctx, func() error {
+		return s.putValue(ctx, s.getRedisNodeIdForMerkleKey(key), v)
+	})
+}
+
+// GetEntry returns the entry of the leaf node stored under key, or
+// ErrNodeNotFound if there is none. It returns an error wrapping ErrCorruptNode
+// if the node isn't a leaf, and one wrapping merkletree.ErrNodeBytesBadSize if
+// the entry isn't two elements long and WithExtendedEntries isn't set. It
+// always reads from Redis.
+func (s *Storage) GetEntry(ctx context.Context, key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+	item, err := s.GetNodeItem(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if merkletree.NodeType(item.Type) != merkletree.NodeTypeLeaf || len(item.ChildL) > 0 || len(item.ChildR) > 0 {
+		return nil, newErr(ErrCorruptNode, fmt.Sprintf("node of type %d isn't a leaf", item.Type))
+	}
+	if err := s.checkEntry(item.Entry); err != nil {
+		return nil, err
+	}
+	return item.Entry, nil
+}
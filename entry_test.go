@@ -0,0 +1,70 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestExtendedEntries(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "extended", WithExtendedEntries(true))
+
+	key := testHash(1)[:]
+	entry := make([]byte, 96)
+	for i := range entry {
+		entry[i] = byte(i)
+	}
+	if err := s.PutEntry(ctx, key, entry); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetEntry(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, entry) {
+		t.Fatalf("GetEntry: got %x, want %x", got, entry)
+	}
+	// a merkletree.Node can't hold it
+	if _, err := s.Get(ctx, key); !errors.Is(err, merkletree.ErrNodeBytesBadSize) {
+		t.Fatalf("Get of an extended entry: got %v, want ErrNodeBytesBadSize", err)
+	}
+
+	// standard stores read the same data strictly
+	standard := NewMerkleRedisStorage(srv.Client(t), "extended")
+	if _, err := standard.GetEntry(ctx, key); !errors.Is(err, merkletree.ErrNodeBytesBadSize) {
+		t.Fatalf("standard GetEntry: got %v, want ErrNodeBytesBadSize", err)
+	}
+	if err := standard.PutEntry(ctx, testHash(2)[:], entry); !errors.Is(err, merkletree.ErrNodeBytesBadSize) {
+		t.Fatalf("standard PutEntry: got %v, want ErrNodeBytesBadSize", err)
+	}
+	if _, ok := srv.Raw(standard.getRedisNodeIdForMerkleKey(testHash(2)[:])); ok {
+		t.Fatal("rejected entry was stored")
+	}
+
+	// standard entries round trip through both
+	if err := standard.PutEntry(ctx, testHash(3)[:], entry[:entryLen]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := standard.Get(ctx, testHash(3)[:]); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetEntry(ctx, testHash(3)[:]); err != nil || !bytes.Equal(got, entry[:entryLen]) {
+		t.Fatalf("GetEntry of a standard entry: got %x, %v", got, err)
+	}
+
+	if err := s.Put(ctx, testHash(4)[:], merkletree.NewNodeEmpty()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetEntry(ctx, testHash(4)[:]); !errors.Is(err, ErrCorruptNode) {
+		t.Fatalf("GetEntry of an empty node: got %v, want ErrCorruptNode", err)
+	}
+	if _, err := s.GetEntry(ctx, testHash(5)[:]); !errors.Is(err, ErrNodeNotFound) {
+		t.Fatalf("GetEntry of a missing node: got %v, want ErrNodeNotFound", err)
+	}
+}
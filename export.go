@@ -0,0 +1,154 @@
+package merkleredis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// exportVersion is the format version written at the start of an export.
+const exportVersion byte = 1
+
+// Export record types.
+const (
+	exportRecordRoot byte = 'r'
+	exportRecordNode byte = 'n'
+)
+
+// importBatchSize is the number of nodes Import writes per PutBatch.
+const importBatchSize = 1000
+
+// ErrInvalidExport is returned by Import for a malformed export stream.
+var ErrInvalidExport = errors.New("invalid export stream")
+
+// Export writes the current root and every node of the tree to w. Nodes that
+// can't be decoded are skipped with a warning to the logger set with
+// WithLogger.
+//
+// The stream starts with a version byte and the source prefix (a uint32 LE
+// length followed by its bytes). Records follow until the end of the stream,
+// each a type byte, a uint32 LE payload length and the payload: 'r' for the
+// 32 byte root hash and 'n' for a serialized NodeItem.
+func (s *Storage) Export(ctx context.Context, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 5, 5+len(s.prefix))
+	header[0] = exportVersion
+	writeUint32LE(header, 1, uint32(len(s.prefix)))
+	header = append(header, s.prefix...)
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	root, err := s.GetRoot(ctx)
+	if err == nil {
+		if err := writeExportRecord(bw, exportRecordRoot, root[:]); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, merkletree.ErrNotFound) {
+		return err
+	}
+
+	err = s.scanNodes(ctx, func(item *NodeItem) error {
+		d, err := MarshalNodeItem(item)
+		if err != nil {
+			return err
+		}
+		return writeExportRecord(bw, exportRecordNode, d)
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeExportRecord(w io.Writer, typ byte, payload []byte) error {
+	var header [5]byte
+	header[0] = typ
+	writeUint32LE(header[:], 1, uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// Import writes the nodes and root of a stream produced by Export into this
+// store. The source prefix is ignored, so a tree can be imported under a
+// different prefix. The root is set only after every node has been written.
+func (s *Storage) Import(ctx context.Context, r io.Reader) error {
+	br := bufio.NewReader(r)
+	var header [5]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return newErr(ErrInvalidExport, "missing header")
+	}
+	if header[0] != exportVersion {
+		return newErr(ErrInvalidExport, fmt.Sprintf("unsupported version %d", header[0]))
+	}
+	if _, err := io.CopyN(io.Discard, br, int64(readUint32LE(header[:], 1))); err != nil {
+		return newErr(ErrInvalidExport, "truncated prefix")
+	}
+
+	var root *merkletree.Hash
+	batch := make([]KV, 0, importBatchSize)
+	for {
+		typ, payload, err := readExportRecord(br)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		switch typ {
+		case exportRecordRoot:
+			if len(payload) != hashLen {
+				return newErr(ErrInvalidExport, "invalid root record")
+			}
+			root = &merkletree.Hash{}
+			copy(root[:], payload)
+		case exportRecordNode:
+			item, err := UnmarshalNodeItem(payload)
+			if err != nil {
+				return err
+			}
+			node, err := item.Node()
+			if err != nil {
+				return err
+			}
+			batch = append(batch, KV{K: item.Key, V: *node})
+			if len(batch) == importBatchSize {
+				if err := s.PutBatch(ctx, batch); err != nil {
+					return err
+				}
+				batch = batch[:0]
+			}
+		default:
+			return newErr(ErrInvalidExport, fmt.Sprintf("unknown record type %d", typ))
+		}
+	}
+	if err := s.PutBatch(ctx, batch); err != nil {
+		return err
+	}
+	if root != nil {
+		return s.SetRoot(ctx, root)
+	}
+	return nil
+}
+
+// readExportRecord reads the next record, returning io.EOF at a clean end of
+// the stream.
+func readExportRecord(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+		return 0, nil, io.EOF
+	} else if err != nil {
+		return 0, nil, newErr(ErrInvalidExport, "truncated record header")
+	}
+	payload := make([]byte, readUint32LE(header[:], 1))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, newErr(ErrInvalidExport, "truncated record")
+	}
+	return header[0], payload, nil
+}
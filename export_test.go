@@ -0,0 +1,59 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	src := NewMerkleRedisStorage(srv.Client(t), "src")
+
+	kvs := testLeafKVs(1500)
+	kvs = append(kvs, KV{K: []byte("mid"), V: *merkletree.NewNodeMiddle(testHash(1), testHash(2))})
+	if err := src.PutBatch(ctx, kvs); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetRoot(ctx, testHash(9)); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := src.Export(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	exported := buf.Bytes()
+
+	dst := NewMerkleRedisStorage(srv.Client(t), "dst")
+	if err := dst.Import(ctx, bytes.NewReader(exported)); err != nil {
+		t.Fatal(err)
+	}
+	root, err := dst.GetRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *root != *testHash(9) {
+		t.Fatalf("root: got %x", root[:])
+	}
+	for _, kv := range kvs {
+		got, err := dst.Get(ctx, kv.K)
+		if err != nil {
+			t.Fatalf("node %x: %v", kv.K, err)
+		}
+		if got.Type != kv.V.Type {
+			t.Fatalf("node %x: got type %d, want %d", kv.K, got.Type, kv.V.Type)
+		}
+	}
+
+	truncated := NewMerkleRedisStorage(srv.Client(t), "truncated")
+	err = truncated.Import(ctx, bytes.NewReader(exported[:len(exported)-1]))
+	if !errors.Is(err, ErrInvalidExport) {
+		t.Fatalf("truncated import: got %v, want ErrInvalidExport", err)
+	}
+}
@@ -0,0 +1,27 @@
+package merkleredis
+
+import "github.com/go-redis/redis/v9"
+
+// StorageFactory derives Storages for a family of trees that share a client
+// and a common prefix namespace.
+type StorageFactory struct {
+	client     redis.UniversalClient
+	basePrefix string
+	opts       []Option
+}
+
+// NewStorageFactory returns a factory for trees stored under basePrefix. The
+// options are applied to every tree it creates.
+func NewStorageFactory(client redis.UniversalClient, basePrefix string, opts ...Option) *StorageFactory {
+	return &StorageFactory{
+		client:     client,
+		basePrefix: basePrefix,
+		opts:       opts,
+	}
+}
+
+// Tree returns the Storage for the tree id, stored with the prefix
+// basePrefix+sep+id, where sep is the separator set with WithSeparator.
+func (f *StorageFactory) Tree(id string) *Storage {
+	return NewMerkleRedisStorageUniversal(f.client, f.basePrefix+separatorOf(f.opts)+id, f.opts...)
+}
@@ -0,0 +1,37 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestStorageFactory(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	f := NewStorageFactory(srv.Client(t), "family")
+	a, b := f.Tree("a"), f.Tree("b")
+
+	if a.getRedisNodeIdForMerkleKey([]byte("k")) == b.getRedisNodeIdForMerkleKey([]byte("k")) {
+		t.Fatal("trees share a node key")
+	}
+	if a.rootId == b.rootId {
+		t.Fatal("trees share a root key")
+	}
+
+	if err := a.Put(ctx, []byte("k"), merkletree.NewNodeLeaf(testHash(1), testHash(2))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get(ctx, []byte("k")); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("node visible in sibling tree: %v", err)
+	}
+	if _, err := a.Get(ctx, []byte("k")); err != nil {
+		t.Fatal(err)
+	}
+	if want := NewMerkleRedisStorage(nil, "family_a"); a.nodeIdPrefix != want.nodeIdPrefix {
+		t.Fatalf("prefix: got %q, want %q", a.nodeIdPrefix, want.nodeIdPrefix)
+	}
+}
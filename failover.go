@@ -0,0 +1,41 @@
+package merkleredis
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// WithFailover mirrors writes to secondary, a second Redis independent of the
+// primary client, and reads from it when the primary fails.
+//
+// The primary stays authoritative. Put, when written synchronously, and
+// SetRoot write to the primary first and fail without touching secondary if
+// that write fails. Once it succeeds they mirror it to secondary; a failed
+// mirror write is reported to the Logger as a warning and doesn't fail the
+// write, so secondary can miss writes made while it was unreachable. Other
+// writes, such as PutBatch, Delete and the root history, aren't mirrored.
+//
+// Get and GetRoot read from secondary when the primary returns an error other
+// than a missing key; a root read from secondary isn't cached. The fallback
+// read shares the operation's context, so a primary that hangs until the
+// deadline leaves it no time; failover covers a primary that fails fast, such
+// as one refusing connections.
+func WithFailover(secondary redis.UniversalClient) Option {
+	return func(s *Storage) {
+		s.secondary = secondary
+	}
+}
+
+// mirror writes what fn queues to the failover client, if one is set, logging
+// failures, see WithFailover. what names the data written in the warning.
+func (s *Storage) mirror(ctx context.Context, what string, fn func(redis.Pipeliner)) {
+	if s.secondary == nil {
+		return
+	}
+	pipe := s.secondary.Pipeline()
+	fn(pipe)
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.warnf("failed to mirror %s to the failover client: %v", what, err)
+	}
+}
@@ -0,0 +1,85 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := fakeredis.New(t), fakeredis.New(t)
+	s := NewMerkleRedisStorage(primary.Client(t), "failover", WithFailover(secondary.Client(t)))
+
+	kvs := testLeafKVs(2)
+	if err := s.Put(ctx, kvs[0].K, &kvs[0].V); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	// writes reach both
+	for _, srv := range []*fakeredis.Server{primary, secondary} {
+		if _, ok := srv.Raw(s.getRedisNodeIdForMerkleKey(kvs[0].K)); !ok {
+			t.Fatal("node not written")
+		}
+		if _, ok := srv.Raw(s.rootId); !ok {
+			t.Fatal("root not written")
+		}
+	}
+
+	// a missing key on a healthy primary doesn't fall back
+	secondary.SetRaw(s.getRedisNodeIdForMerkleKey(kvs[1].K), primary.Lookup(s.getRedisNodeIdForMerkleKey(kvs[0].K)).Str)
+	if _, err := s.Get(ctx, kvs[1].K); !errors.Is(err, ErrNodeNotFound) {
+		t.Fatalf("Get of a key missing on the primary: got %v, want ErrNodeNotFound", err)
+	}
+
+	primary.Close()
+	fresh := NewMerkleRedisStorage(primary.Client(t), "failover", WithFailover(secondary.Client(t)))
+	node, err := fresh.Get(ctx, kvs[0].K)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := node.Key()
+	want, _ := kvs[0].V.Key()
+	if *got != *want {
+		t.Fatal("Get returned another node")
+	}
+	root, err := fresh.GetRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *root != *testHash(1) {
+		t.Fatalf("GetRoot: got %x", root[:])
+	}
+	if fresh.cachedRoot() != nil {
+		t.Fatal("root read from the secondary was cached")
+	}
+
+	// writes fail with the primary and leave the secondary alone
+	if err := fresh.SetRoot(ctx, testHash(2)); err == nil {
+		t.Fatal("SetRoot succeeded with the primary down")
+	}
+	if v, _ := secondary.Raw(s.rootId); string(v) != string(testHash(1)[:]) {
+		t.Fatal("failed SetRoot was mirrored")
+	}
+}
+
+func TestFailoverMirrorError(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := fakeredis.New(t), fakeredis.New(t)
+	logger := &recordingLogger{}
+	s := NewMerkleRedisStorage(primary.Client(t), "failover",
+		WithFailover(secondary.Client(t)), WithLogger(logger))
+
+	secondary.Close()
+	if err := s.SetRoot(ctx, &merkletree.HashZero); err != nil {
+		t.Fatalf("SetRoot with the secondary down: %v", err)
+	}
+	if len(logger.warnings) != 1 {
+		t.Fatalf("got warnings %q, want 1", logger.warnings)
+	}
+}
@@ -0,0 +1,78 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// formatSuffix is appended to the root key to form the key holding the format
+// version of the tree.
+const formatSuffix = "_meta"
+
+// currentFormatVersion is the format version of the trees written by this
+// release, see WithFormatVersion. It changes when a release stores trees in a
+// way earlier releases can't read, or reads earlier trees differently.
+const currentFormatVersion = 1
+
+// ErrIncompatibleFormat is returned by CheckFormat and
+// NewMerkleRedisStorageChecked when the tree was written in another format
+// version than the store expects.
+var ErrIncompatibleFormat = errors.New("incompatible merkle tree format")
+
+// WithFormatVersion sets the format version the store records on its first
+// write and expects from the tree, instead of the version of this release. It
+// lets a migration open a tree at its old version, or record the new one on a
+// tree it has converted.
+func WithFormatVersion(v int) Option {
+	return func(s *Storage) {
+		s.formatVersion = v
+	}
+}
+
+// expectedFormat returns the format version set with WithFormatVersion, or
+// currentFormatVersion.
+func (s *Storage) expectedFormat() int {
+	if s.formatVersion == 0 {
+		return currentFormatVersion
+	}
+	return s.formatVersion
+}
+
+// CheckFormat returns an error wrapping ErrIncompatibleFormat if the tree
+// records another format version than the store expects. Trees without a
+// recorded version, which have no root yet or were written by releases
+// predating format versions, are taken as compatible. The version is recorded
+// next to the root by the first write of a root by a store, with the store's
+// TTL, unless one is already recorded; Clear removes it.
+func (s *Storage) CheckFormat(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	v, err := s.db.Get(ctx, s.rootId+formatSuffix).Result()
+	if err == redis.Nil {
+		return nil
+	} else if err != nil {
+		return newErr(err, "failed to read format version")
+	}
+	if v != strconv.Itoa(s.expectedFormat()) {
+		return newErr(ErrIncompatibleFormat, fmt.Sprintf("tree %s has format version %s, store expects %d", s.prefix, v, s.expectedFormat()))
+	}
+	return nil
+}
+
+// recordFormat records the format version of the tree unless one is already
+// recorded, once per store, before the store writes a root.
+func (s *Storage) recordFormat(ctx context.Context) error {
+	if s.formatRecorded.Load() {
+		return nil
+	}
+	if err := s.db.SetNX(ctx, s.rootId+formatSuffix, s.expectedFormat(), s.ttl).Err(); err != nil {
+		return newErr(err, "failed to record format version")
+	}
+	s.formatRecorded.Store(true)
+	return nil
+}
@@ -0,0 +1,79 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+)
+
+func TestFormatVersion(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	v1 := NewMerkleRedisStorage(srv.Client(t), "format", WithFormatVersion(1))
+
+	// nodes alone don't record it
+	if err := v1.PutBatch(ctx, testLeafKVs(2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.Raw(v1.rootId + formatSuffix); ok {
+		t.Fatal("format version recorded without a root")
+	}
+	for i := byte(1); i <= 2; i++ {
+		if err := v1.SetRoot(ctx, testHash(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, _ := srv.Raw(v1.rootId + formatSuffix); string(v) != "1" {
+		t.Fatalf("recorded format version %q, want 1", v)
+	}
+	if n := srv.Count("SETNX"); n != 1 {
+		t.Fatalf("recorded the format version %d times, want once", n)
+	}
+
+	_, err := NewMerkleRedisStorageChecked(ctx, srv.Client(t), "format", WithFormatVersion(2))
+	if !errors.Is(err, ErrIncompatibleFormat) {
+		t.Fatalf("v2 store on v1 data: got %v, want ErrIncompatibleFormat", err)
+	}
+	if !strings.Contains(err.Error(), "format version 1, store expects 2") {
+		t.Fatalf("unclear error %q", err)
+	}
+	if _, err := NewMerkleRedisStorageChecked(ctx, srv.Client(t), "format"); err != nil {
+		t.Fatalf("current store on v1 data: %v", err)
+	}
+
+	// a v2 store doesn't overwrite the recorded version
+	v2 := NewMerkleRedisStorage(srv.Client(t), "format", WithFormatVersion(2))
+	if err := v2.SetRoot(ctx, testHash(3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := v2.CheckFormat(ctx); !errors.Is(err, ErrIncompatibleFormat) {
+		t.Fatalf("CheckFormat: got %v, want ErrIncompatibleFormat", err)
+	}
+
+	// trees predating format versions are compatible with any store
+	srv.Delete(v1.rootId + formatSuffix)
+	if err := v2.CheckFormat(ctx); err != nil {
+		t.Fatalf("tree without a format version: %v", err)
+	}
+
+	if err := v1.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	v2 = NewMerkleRedisStorage(srv.Client(t), "format", WithFormatVersion(2))
+	txn, err := v2.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.SetRoot(ctx, testHash(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := srv.Raw(v2.rootId + formatSuffix); string(v) != "2" {
+		t.Fatalf("transaction recorded format version %q, want 2", v)
+	}
+}
@@ -0,0 +1,184 @@
+package merkleredis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// gcLockTTL bounds how long GC holds the tree lock, should it fail to release
+// it.
+const gcLockTTL = 10 * time.Minute
+
+// GC deletes the nodes no longer reachable from the tree's roots, which
+// accumulate as SetRoot replaces the root, and returns how many it removed.
+// Nodes are kept if they are reachable from the current root, a root of the
+// history kept by WithRootHistory or a root set with SetLabeledRoot.
+//
+// GC first walks the reachable nodes level by level, then scans every node key
+// of the tree and deletes the others. It holds the tree lock, see Lock, for
+// the whole run and returns ErrLocked without deleting anything if it is held.
+// Writers must take the lock too, as a node written by a writer that doesn't
+// could be deleted before the root referencing it is set. If a reachable node
+// is missing or can't be decoded GC returns an error without deleting
+// anything, as it can't tell which nodes lie below it. The walk reads from the
+// primary even with WithReadClient, so that a lagging replica can't make
+// reachable nodes look unreachable. On Redis Cluster the nodes of a level must
+// hash to the same slot, see GetMulti.
+func (s *Storage) GC(ctx context.Context) (removed int64, err error) {
+	unlock, err := s.Lock(ctx, gcLockTTL)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if uerr := unlock(); uerr != nil && err == nil {
+			err = uerr
+		}
+	}()
+
+	roots, err := s.gcRoots(ctx)
+	if err != nil {
+		return 0, err
+	}
+	reachable, err := s.reachableNodes(ctx, roots)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.scanNodeKeys(ctx, func(keys []string) error {
+		orphans := keys[:0]
+		for _, k := range keys {
+			if _, ok := reachable[k]; !ok {
+				orphans = append(orphans, k)
+			}
+		}
+		if len(orphans) == 0 {
+			return nil
+		}
+		n, err := s.deleteNodeKeys(ctx, orphans)
+		removed += n
+		return err
+	})
+	// the cache may hold deleted nodes
+	s.nodeCache.purge()
+	return removed, err
+}
+
+// gcRoots returns the roots whose nodes GC keeps, read from Redis rather than
+// the root cache so that roots set by other processes are kept.
+func (s *Storage) gcRoots(ctx context.Context) ([]*merkletree.Hash, error) {
+	roots, err := s.GetRootHistory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{s.rootId}
+	err = s.scanKeys(ctx, globEscape(s.labeledRootId(""))+"*", func(keys []string) error {
+		ids = append(ids, keys...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		root, err := s.readRoot(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if root != nil {
+			roots = append(roots, root)
+		}
+	}
+	return roots, nil
+}
+
+// readRoot reads the root stored under id from the primary, returning nil if
+// there is none.
+func (s *Storage) readRoot(ctx context.Context, id string) (*merkletree.Hash, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	v, err := s.db.Get(ctx, id).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, newErr(err, "failed to read root")
+	}
+	var root merkletree.Hash
+	if err := s.decodeRoot(id, v, &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// reachableNodes returns the Redis keys of the nodes reachable from roots,
+// read from the primary. A missing node is an error wrapping ErrNodeNotFound.
+func (s *Storage) reachableNodes(ctx context.Context, roots []*merkletree.Hash) (map[string]struct{}, error) {
+	reachable := map[string]struct{}{}
+	var level [][]byte
+	visit := func(h *merkletree.Hash) {
+		if *h == merkletree.HashZero {
+			return
+		}
+		id := s.getRedisNodeIdForMerkleKey(h[:])
+		if _, ok := reachable[id]; !ok {
+			reachable[id] = struct{}{}
+			level = append(level, append([]byte(nil), h[:]...))
+		}
+	}
+	for _, root := range roots {
+		visit(root)
+	}
+	for len(level) > 0 {
+		current := level
+		level = nil
+		for start := 0; start < len(current); start += verifyBatchSize {
+			end := start + verifyBatchSize
+			if end > len(current) {
+				end = len(current)
+			}
+			nodes, err := s.getMulti(ctx, s.db, current[start:end])
+			if err != nil {
+				return nil, err
+			}
+			for i, node := range nodes {
+				if node == nil {
+					return nil, newErr(ErrNodeNotFound, fmt.Sprintf("reachable node %x is missing", current[start+i]))
+				}
+				if node.Type == merkletree.NodeTypeMiddle {
+					visit(node.ChildL)
+					visit(node.ChildR)
+				}
+			}
+		}
+	}
+	return reachable, nil
+}
+
+// deleteNodeKeys removes the node keys with one pipelined DEL per key and
+// returns how many existed, keeping the node counter in step.
+func (s *Storage) deleteNodeKeys(ctx context.Context, keys []string) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	pipe := s.db.Pipeline()
+	dels := make([]*redis.IntCmd, len(keys))
+	for i, k := range keys {
+		dels[i] = pipe.Del(ctx, k)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, newErr(err, "failed to delete nodes")
+	}
+	var n int64
+	for _, del := range dels {
+		n += del.Val()
+	}
+	if s.nodeCounter && n > 0 {
+		if err := s.db.DecrBy(ctx, s.rootId+nodeCountSuffix, n).Err(); err != nil {
+			return n, newErr(err, "failed to update node count")
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,148 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+)
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "gc", WithNodeCounter())
+
+	mt := newTestTree(t, s, 8)
+	if err := s.SetLabeledRoot(ctx, "v1", mt.Root()); err != nil {
+		t.Fatal(err)
+	}
+	labeled := mt.Root()
+	for i := 8; i < 12; i++ {
+		if err := mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i)*10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	junk := testLeafKVs(5)
+	if err := s.PutBatch(ctx, junk); err != nil {
+		t.Fatal(err)
+	}
+	before := nodeKeys(srv, s)
+
+	removed, err := s.GC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := nodeKeys(srv, s)
+	if removed <= int64(len(junk)) || removed != int64(len(before)-len(after)) {
+		t.Fatalf("removed %d of %d nodes, %d left", removed, len(before), len(after))
+	}
+	for _, kv := range junk {
+		if _, ok := srv.Raw(s.getRedisNodeIdForMerkleKey(kv.K)); ok {
+			t.Fatalf("unreachable node %x survived", kv.K)
+		}
+	}
+
+	// the current and the labeled tree are intact
+	if problems, err := s.VerifyIntegrity(ctx); err != nil || len(problems) != 0 {
+		t.Fatalf("current tree: got %v, %v", problems, err)
+	}
+	for i := 0; i < 8; i++ {
+		proof, value, err := mt.GenerateProof(ctx, big.NewInt(int64(i)), labeled)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proof.Existence || value.Int64() != int64(i)*10 {
+			t.Fatalf("labeled tree lost key %d", i)
+		}
+	}
+	if n, err := s.NodeCount(ctx); err != nil || n != int64(len(after)) {
+		t.Fatalf("NodeCount: got %d, %v, want %d", n, err, len(after))
+	}
+	if removed, err := s.GC(ctx); err != nil || removed != 0 {
+		t.Fatalf("second GC: got %d, %v", removed, err)
+	}
+}
+
+func TestGCLocked(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "gc")
+
+	if err := s.PutBatch(ctx, testLeafKVs(3)); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := s.Lock(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GC(ctx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("got %v, want ErrLocked", err)
+	}
+	if n := len(nodeKeys(srv, s)); n != 3 {
+		t.Fatalf("%d nodes left, want 3", n)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	// without a root nothing is reachable
+	if removed, err := s.GC(ctx); err != nil || removed != 3 {
+		t.Fatalf("got %d, %v, want 3", removed, err)
+	}
+	if _, ok := srv.Raw(s.rootId + lockSuffix); ok {
+		t.Fatal("GC didn't release the lock")
+	}
+}
+
+func TestGCReadsPrimary(t *testing.T) {
+	ctx := context.Background()
+	primary, replica := fakeredis.New(t), fakeredis.New(t)
+	direct := NewMerkleRedisStorage(primary.Client(t), "gc")
+	newTestTree(t, direct, 4)
+	// the replica lags behind and holds nothing
+	s := NewMerkleRedisStorage(primary.Client(t), "gc", WithReadClient(replica.Client(t)))
+
+	if _, err := s.GC(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := direct.VerifyIntegrity(ctx); err != nil || len(problems) != 0 {
+		t.Fatalf("got %v, %v", problems, err)
+	}
+}
+
+func TestGCMissingNode(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "gc")
+
+	mt := newTestTree(t, s, 4)
+	junk := testLeafKVs(2)
+	if err := s.PutBatch(ctx, junk); err != nil {
+		t.Fatal(err)
+	}
+	root, err := s.Get(ctx, mt.Root()[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Delete(s.getRedisNodeIdForMerkleKey(root.ChildL[:]))
+	before := len(nodeKeys(srv, s))
+
+	if _, err := s.GC(ctx); !errors.Is(err, ErrNodeNotFound) {
+		t.Fatalf("got %v, want ErrNodeNotFound", err)
+	}
+	if n := len(nodeKeys(srv, s)); n != before {
+		t.Fatalf("%d nodes left, want %d", n, before)
+	}
+}
+
+// nodeKeys returns the node keys of s stored on srv.
+func nodeKeys(srv *fakeredis.Server, s *Storage) []string {
+	var keys []string
+	for _, k := range srv.Keys() {
+		if strings.HasPrefix(k, s.nodeIdPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -3,10 +3,13 @@ module github.com/OpenAssetStandards/go-merkletree-redis-store
 go 1.19
 
 require (
-	github.com/cespare/xxhash/v2 v2.2.0 // indirect
-	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-	github.com/go-redis/redis/v9 v9.0.0-rc.2 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f
+	github.com/go-redis/redis/v9 v9.0.0-rc.2
+	github.com/iden3/go-merkletree-sql/v2 v2.0.0
+)
+
+require (
 	github.com/iden3/go-iden3-crypto v0.0.13 // indirect
-	github.com/iden3/go-merkletree-sql/v2 v2.0.0 // indirect
 	golang.org/x/sys v0.3.0 // indirect
 )
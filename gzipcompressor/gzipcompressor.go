@@ -0,0 +1,44 @@
+// Package gzipcompressor provides a gzip merkleredis.Compressor.
+package gzipcompressor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// Compressor compresses node values with gzip.
+type Compressor struct {
+	level int
+}
+
+// New returns a Compressor using the given compress/gzip level.
+func New(level int) *Compressor {
+	return &Compressor{level: level}
+}
+
+// Compress returns the gzip compressed form of d.
+func (c *Compressor) Compress(d []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, c.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(d); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress returns the data compressed in d.
+func (c *Compressor) Decompress(d []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(d))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
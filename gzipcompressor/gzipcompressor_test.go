@@ -0,0 +1,29 @@
+package gzipcompressor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	c := New(gzip.BestCompression)
+	in := bytes.Repeat([]byte("merkle"), 1000)
+	out, err := c.Compress(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) >= len(in) {
+		t.Fatalf("compressed %d bytes into %d", len(in), len(out))
+	}
+	got, err := c.Decompress(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, in) {
+		t.Fatal("round trip mismatch")
+	}
+	if _, err := c.Decompress([]byte("not gzip")); err == nil {
+		t.Fatal("expected an error for invalid input")
+	}
+}
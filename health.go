@@ -0,0 +1,17 @@
+package merkleredis
+
+import (
+	"context"
+)
+
+// Ping checks that the backing Redis answers a PING, for readiness probes
+// that want to verify the store without a full operation.
+func (s *Storage) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if err := s.db.Ping(ctx).Err(); err != nil {
+		return newErr(err, "failed to ping redis")
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package merkleredis
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "ping")
+
+	if err := s.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Count("PING"); n != 1 {
+		t.Fatalf("got %d PINGs, want 1", n)
+	}
+	srv.Close()
+	if err := s.Ping(ctx); err == nil {
+		t.Fatal("Ping succeeded against a closed server")
+	}
+}
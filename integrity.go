@@ -0,0 +1,181 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// verifyBatchSize is the number of nodes VerifyIntegrity reads per GetMulti.
+const verifyBatchSize = 1000
+
+// IntegrityProblemKind classifies the problems found by VerifyIntegrity.
+type IntegrityProblemKind int
+
+const (
+	// MissingNode is a node referenced by the root or a middle node that isn't
+	// stored.
+	MissingNode IntegrityProblemKind = iota
+	// CorruptNode is a stored node that can't be decoded.
+	CorruptNode
+	// InvalidNode is a node of an unexpected type or shape, or whose hash
+	// doesn't match the key it is stored under.
+	InvalidNode
+)
+
+func (k IntegrityProblemKind) String() string {
+	switch k {
+	case MissingNode:
+		return "missing node"
+	case CorruptNode:
+		return "corrupt node"
+	case InvalidNode:
+		return "invalid node"
+	default:
+		return fmt.Sprintf("IntegrityProblemKind(%d)", int(k))
+	}
+}
+
+// IntegrityProblem is a problem found by VerifyIntegrity.
+type IntegrityProblem struct {
+	Kind IntegrityProblemKind
+	// Key is the key of the node with the problem.
+	Key []byte
+	// Parent is the key of the middle node referencing Key, nil for the root.
+	Parent []byte
+	// Detail describes the problem.
+	Detail string
+}
+
+func (p IntegrityProblem) String() string {
+	return fmt.Sprintf("%v %x (parent %x): %s", p.Kind, p.Key, p.Parent, p.Detail)
+}
+
+type nodeRef struct {
+	key    []byte
+	parent []byte
+}
+
+// VerifyIntegrity walks the tree from the root, level by level, and returns
+// every node that is missing, can't be decoded, or is inconsistent with its
+// key, instead of stopping at the first one. The subtrees below a bad node are
+// not visited. Nodes that can't be decoded are also reported as warnings to
+// the logger set with WithLogger. An empty tree has no problems. err is only
+// set when the walk itself fails, for example because Redis is unreachable. On
+// Redis Cluster the nodes of a level must hash to the same slot, see GetMulti.
+func (s *Storage) VerifyIntegrity(ctx context.Context) (problems []IntegrityProblem, err error) {
+	root, err := s.GetRoot(ctx)
+	if errors.Is(err, merkletree.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if *root == merkletree.HashZero {
+		return nil, nil
+	}
+
+	level := []nodeRef{{key: root[:]}}
+	for len(level) > 0 {
+		var next []nodeRef
+		for start := 0; start < len(level); start += verifyBatchSize {
+			end := start + verifyBatchSize
+			if end > len(level) {
+				end = len(level)
+			}
+			if err := ctx.Err(); err != nil {
+				return problems, err
+			}
+			batch := level[start:end]
+			nodes, errs, err := s.verifyFetch(ctx, batch)
+			if err != nil {
+				return problems, err
+			}
+			for i, ref := range batch {
+				p := IntegrityProblem{Key: ref.key, Parent: ref.parent}
+				switch {
+				case errs[i] != nil:
+					p.Kind, p.Detail = CorruptNode, errs[i].Error()
+					s.warnf("corrupt node %x: %v", ref.key, errs[i])
+				case nodes[i] == nil:
+					p.Kind, p.Detail = MissingNode, "not stored"
+				default:
+					children, detail := checkNode(ref.key, nodes[i])
+					if detail != "" {
+						p.Kind, p.Detail = InvalidNode, detail
+						break
+					}
+					next = append(next, children...)
+					continue
+				}
+				problems = append(problems, p)
+			}
+		}
+		level = next
+	}
+	return problems, nil
+}
+
+// verifyFetch reads the nodes of refs with GetMulti. If some of them can't be
+// decoded, it reads them one by one to report which.
+func (s *Storage) verifyFetch(ctx context.Context, refs []nodeRef) ([]*merkletree.Node, []error, error) {
+	keys := make([][]byte, len(refs))
+	for i, ref := range refs {
+		keys[i] = ref.key
+	}
+	errs := make([]error, len(refs))
+	nodes, err := s.GetMulti(ctx, keys)
+	if err == nil {
+		return nodes, errs, nil
+	}
+	if !errors.Is(err, ErrCorruptNode) && !errors.Is(err, merkletree.ErrNodeBytesBadSize) {
+		return nil, nil, err
+	}
+	nodes = make([]*merkletree.Node, len(refs))
+	for i, k := range keys {
+		node, err := s.Get(ctx, k)
+		switch {
+		case err == nil:
+			nodes[i] = node
+		case errors.Is(err, merkletree.ErrNotFound):
+		case errors.Is(err, ErrCorruptNode) || errors.Is(err, merkletree.ErrNodeBytesBadSize):
+			errs[i] = err
+		default:
+			return nil, nil, err
+		}
+	}
+	return nodes, errs, nil
+}
+
+// checkNode checks that node is a middle or leaf node hashing to key. It
+// returns the non-empty children to visit, or a description of the problem.
+func checkNode(key []byte, node *merkletree.Node) ([]nodeRef, string) {
+	var children []nodeRef
+	switch node.Type {
+	case merkletree.NodeTypeMiddle:
+		if node.ChildL == nil || node.ChildR == nil {
+			return nil, "middle node without both children"
+		}
+		for _, c := range []*merkletree.Hash{node.ChildL, node.ChildR} {
+			if *c != merkletree.HashZero {
+				children = append(children, nodeRef{key: append([]byte(nil), c[:]...), parent: key})
+			}
+		}
+	case merkletree.NodeTypeLeaf:
+		if node.Entry[0] == nil || node.Entry[1] == nil {
+			return nil, "leaf node without an entry"
+		}
+	default:
+		return nil, fmt.Sprintf("unexpected node type %d", node.Type)
+	}
+	h, err := node.Key()
+	if err != nil {
+		return nil, fmt.Sprintf("failed to hash node: %v", err)
+	}
+	if !bytes.Equal(h[:], key) {
+		return nil, fmt.Sprintf("node hashes to %x", h[:])
+	}
+	return children, ""
+}
@@ -0,0 +1,78 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// newTestTree builds a tree of n leaves on s.
+func newTestTree(t *testing.T, s *Storage, n int) *merkletree.MerkleTree {
+	t.Helper()
+	ctx := context.Background()
+	mt, err := merkletree.NewMerkleTree(ctx, s, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i)*10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return mt
+}
+
+func TestVerifyIntegrity(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "verify")
+
+	if problems, err := s.VerifyIntegrity(ctx); err != nil || len(problems) != 0 {
+		t.Fatalf("empty tree: got %v, %v", problems, err)
+	}
+
+	mt := newTestTree(t, s, 8)
+	if problems, err := s.VerifyIntegrity(ctx); err != nil || len(problems) != 0 {
+		t.Fatalf("intact tree: got %v, %v", problems, err)
+	}
+
+	root, err := s.Get(ctx, mt.Root()[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Type != merkletree.NodeTypeMiddle {
+		t.Fatalf("root is a %d node", root.Type)
+	}
+	// one dangling and one corrupt child of the root
+	if err := s.Delete(ctx, root.ChildL[:]); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetRaw(s.getRedisNodeIdForMerkleKey(root.ChildR[:]), []byte("garbage"))
+
+	problems, err := s.VerifyIntegrity(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("got %d problems, want 2: %v", len(problems), problems)
+	}
+	for _, p := range problems {
+		if !bytes.Equal(p.Parent, mt.Root()[:]) {
+			t.Fatalf("%v: parent is not the root", p)
+		}
+		switch {
+		case bytes.Equal(p.Key, root.ChildL[:]):
+			if p.Kind != MissingNode {
+				t.Fatalf("deleted child: got %v", p)
+			}
+		case bytes.Equal(p.Key, root.ChildR[:]):
+			if p.Kind != CorruptNode {
+				t.Fatalf("corrupt child: got %v", p)
+			}
+		default:
+			t.Fatalf("unexpected problem %v", p)
+		}
+	}
+}
@@ -0,0 +1,1251 @@
+// Package fakeredis is a minimal in-process RESP2 server implementing the
+// subset of Redis commands the store issues, so tests don't need a running
+// redis-server.
+package fakeredis
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// Server is a fake Redis server listening on a local port.
+type Server struct {
+	ln net.Listener
+
+	mu sync.Mutex
+	// data is the keyspace of the database selected by the connection whose
+	// command is being run, db its index and dbs every database.
+	data map[string]*Value
+	db   int
+	dbs  map[int]map[string]*Value
+	cmds map[string]int
+	// loaded holds the SHA1 of every script loaded
+	loaded map[string]bool
+	// libraries holds the names of the function libraries loaded.
+	libraries map[string]bool
+	// cursors maps SCAN cursors to the keys left to scan
+	cursors    map[int][]string
+	nextCursor int
+	// skew is added to the wall clock when evaluating expiry, see FastForward.
+	skew time.Duration
+	// subs maps channels to their subscribed connections.
+	subs map[string]map[*Conn]bool
+	// notify enables keyspace notifications, see EnableKeyspaceNotifications.
+	notify bool
+	// cluster enables CROSSSLOT checks, see ClusterClient.
+	cluster bool
+	// shards are the nodes of the cluster the server is part of, in slot
+	// order, see NewCluster; nil for a cluster of the server alone.
+	shards []*Server
+	// disabled holds the commands replied to as unknown, see Disable.
+	disabled map[string]bool
+	// latency delays the reply to every command but CLUSTER, see SetLatency.
+	latency atomic.Int64
+	// conns holds the open client connections, closed by Close.
+	conns map[net.Conn]bool
+}
+
+// Value is a stored string or list, with an optional expiry.
+type Value struct {
+	Str      []byte
+	List     [][]byte
+	IsList   bool
+	ExpireAt time.Time
+}
+
+// Conn is a client connection. Script emulations use it to access the server
+// and write their reply.
+type Conn struct {
+	Srv *Server
+	w   *bufio.Writer
+	// db is the selected database.
+	db int
+	// channels holds the channels the connection is subscribed to.
+	channels map[string]bool
+	// queued holds the commands queued since MULTI, nil outside a
+	// transaction, and aborted whether one of them was rejected.
+	queued  [][][]byte
+	aborted bool
+}
+
+type handler func(c *Conn, args [][]byte)
+
+var commands map[string]handler
+
+// memoryOverhead is the per-key overhead MEMORY USAGE reports on top of the
+// key and value lengths.
+const memoryOverhead = 56
+
+// Script emulates a Lua script of the store in Go. The fake server has no
+// Lua interpreter, so scripts are dispatched by SHA1 to these emulations,
+// which tests register with RegisterScript. The server lock is held while a
+// script runs.
+type Script func(c *Conn, keys, argv [][]byte)
+
+var scripts = map[string]Script{}
+
+// RegisterScript registers fn as the emulation of the script with the given
+// SHA1. It must be called before any server is started, typically from init.
+func RegisterScript(sha string, fn Script) {
+	scripts[sha] = fn
+}
+
+// function is a Redis Function emulated in Go, see RegisterFunction.
+type function struct {
+	library string
+	fn      Script
+}
+
+var functions = map[string]function{}
+
+// RegisterFunction registers fn as the emulation of the Redis Function name
+// of the library named library. FCALL runs it once the library has been
+// loaded with FUNCTION LOAD, whose code is otherwise ignored. Like
+// RegisterScript it must be called before any server is started.
+func RegisterFunction(library, name string, fn Script) {
+	functions[name] = function{library: library, fn: fn}
+}
+
+func init() {
+	commands = map[string]handler{
+		"MULTI": func(c *Conn, args [][]byte) {
+			if c.queued != nil {
+				c.WriteError("ERR MULTI calls can not be nested")
+				return
+			}
+			c.queued = [][][]byte{}
+			c.WriteStatus("OK")
+		},
+		"EXEC": func(c *Conn, args [][]byte) {
+			if c.queued == nil {
+				c.WriteError("ERR EXEC without MULTI")
+				return
+			}
+			queued, aborted := c.queued, c.aborted
+			c.queued, c.aborted = nil, false
+			if aborted {
+				c.WriteError("EXECABORT Transaction discarded because of previous errors.")
+				return
+			}
+			// the server lock is held throughout, so the commands run
+			// without others in between
+			c.WriteArrayLen(len(queued))
+			for _, args := range queued {
+				commands[strings.ToUpper(string(args[0]))](c, args[1:])
+			}
+		},
+		"DISCARD": func(c *Conn, args [][]byte) {
+			if c.queued == nil {
+				c.WriteError("ERR DISCARD without MULTI")
+				return
+			}
+			c.queued, c.aborted = nil, false
+			c.WriteStatus("OK")
+		},
+		"PING": func(c *Conn, args [][]byte) {
+			if len(c.channels) > 0 {
+				c.WriteArrayLen(2)
+				c.WriteBulk([]byte("pong"))
+				c.WriteBulk(nil)
+				return
+			}
+			c.WriteStatus("PONG")
+		},
+		"SELECT": func(c *Conn, args [][]byte) {
+			if len(args) != 1 {
+				c.WriteArgErr("select")
+				return
+			}
+			n, err := strconv.Atoi(string(args[0]))
+			if err != nil || n < 0 || n > 15 {
+				c.WriteError("ERR DB index is out of range")
+				return
+			}
+			c.db = n
+			c.Srv.selectDB(n)
+			c.WriteStatus("OK")
+		},
+		"SUBSCRIBE": func(c *Conn, args [][]byte) {
+			if len(args) == 0 {
+				c.WriteArgErr("subscribe")
+				return
+			}
+			for _, ch := range args {
+				c.subscribe(string(ch))
+				c.writeSubscription("subscribe", ch)
+			}
+		},
+		"UNSUBSCRIBE": func(c *Conn, args [][]byte) {
+			if len(args) == 0 {
+				if len(c.channels) == 0 {
+					c.writeSubscription("unsubscribe", nil)
+				}
+				for ch := range c.channels {
+					args = append(args, []byte(ch))
+				}
+			}
+			for _, ch := range args {
+				c.unsubscribe(string(ch))
+				c.writeSubscription("unsubscribe", ch)
+			}
+		},
+		"PUBLISH": func(c *Conn, args [][]byte) {
+			if len(args) != 2 {
+				c.WriteArgErr("publish")
+				return
+			}
+			c.WriteInt(int64(c.Srv.publish(string(args[0]), args[1])))
+		},
+		"GET": func(c *Conn, args [][]byte) {
+			if len(args) != 1 {
+				c.WriteArgErr("get")
+				return
+			}
+			v := c.Srv.Lookup(string(args[0]))
+			if v == nil {
+				c.WriteNil()
+				return
+			}
+			if v.IsList {
+				c.WriteWrongType()
+				return
+			}
+			c.WriteBulk(v.Str)
+		},
+		"GETEX": func(c *Conn, args [][]byte) {
+			if len(args) == 0 {
+				c.WriteArgErr("getex")
+				return
+			}
+			v := c.Srv.Lookup(string(args[0]))
+			if v != nil && v.IsList {
+				c.WriteWrongType()
+				return
+			}
+			var expireAt time.Time
+			set := false
+			for i := 1; i < len(args); i++ {
+				switch opt := strings.ToUpper(string(args[i])); opt {
+				case "PERSIST":
+					set = true
+				case "EX", "PX":
+					if i+1 >= len(args) {
+						c.WriteError("ERR syntax error")
+						return
+					}
+					n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+					if err != nil || n <= 0 {
+						c.WriteError("ERR invalid expire time in 'getex' command")
+						return
+					}
+					unit := time.Second
+					if opt == "PX" {
+						unit = time.Millisecond
+					}
+					expireAt, set = c.Srv.now().Add(time.Duration(n)*unit), true
+					i++
+				default:
+					c.WriteError("ERR syntax error")
+					return
+				}
+			}
+			if v == nil {
+				c.WriteNil()
+				return
+			}
+			if set {
+				v.ExpireAt = expireAt
+			}
+			c.WriteBulk(v.Str)
+		},
+		"MGET": func(c *Conn, args [][]byte) {
+			if c.crossSlot(args) {
+				return
+			}
+			c.WriteArrayLen(len(args))
+			for _, k := range args {
+				if v := c.Srv.Lookup(string(k)); v != nil && !v.IsList {
+					c.WriteBulk(v.Str)
+				} else {
+					c.WriteNil()
+				}
+			}
+		},
+		"SETNX": func(c *Conn, args [][]byte) {
+			if len(args) != 2 {
+				c.WriteArgErr("setnx")
+				return
+			}
+			if c.Srv.Lookup(string(args[0])) != nil {
+				c.WriteInt(0)
+				return
+			}
+			c.Srv.data[string(args[0])] = &Value{Str: append([]byte(nil), args[1]...)}
+			c.Srv.notifyKeyspace(string(args[0]), "set")
+			c.WriteInt(1)
+		},
+		"SET": func(c *Conn, args [][]byte) {
+			if len(args) < 2 {
+				c.WriteArgErr("set")
+				return
+			}
+			v := &Value{Str: append([]byte(nil), args[1]...)}
+			var nx, xx, get bool
+			for i := 2; i < len(args); i++ {
+				switch opt := strings.ToUpper(string(args[i])); opt {
+				case "GET":
+					get = true
+				case "NX":
+					nx = true
+				case "XX":
+					xx = true
+				case "EX", "PX":
+					if i+1 >= len(args) {
+						c.WriteError("ERR syntax error")
+						return
+					}
+					n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+					if err != nil || n <= 0 {
+						c.WriteError("ERR invalid expire time in 'set' command")
+						return
+					}
+					unit := time.Second
+					if opt == "PX" {
+						unit = time.Millisecond
+					}
+					v.ExpireAt = c.Srv.now().Add(time.Duration(n) * unit)
+					i++
+				default:
+					c.WriteError("ERR syntax error")
+					return
+				}
+			}
+			old := c.Srv.Lookup(string(args[0]))
+			if get && old != nil && old.IsList {
+				c.WriteWrongType()
+				return
+			}
+			exists := old != nil
+			if (nx && exists) || (xx && !exists) {
+				c.WriteNil()
+				return
+			}
+			c.Srv.data[string(args[0])] = v
+			c.Srv.notifyKeyspace(string(args[0]), "set")
+			switch {
+			case !get:
+				c.WriteStatus("OK")
+			case old == nil:
+				c.WriteNil()
+			default:
+				c.WriteBulk(old.Str)
+			}
+		},
+		"INCR": func(c *Conn, args [][]byte) {
+			if len(args) != 1 {
+				c.WriteArgErr("incr")
+				return
+			}
+			c.incrBy(args[0], 1)
+		},
+		"DECR": func(c *Conn, args [][]byte) {
+			if len(args) != 1 {
+				c.WriteArgErr("decr")
+				return
+			}
+			c.incrBy(args[0], -1)
+		},
+		"INCRBY": func(c *Conn, args [][]byte) {
+			if len(args) != 2 {
+				c.WriteArgErr("incrby")
+				return
+			}
+			n, err := strconv.ParseInt(string(args[1]), 10, 64)
+			if err != nil {
+				c.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			c.incrBy(args[0], n)
+		},
+		"DECRBY": func(c *Conn, args [][]byte) {
+			if len(args) != 2 {
+				c.WriteArgErr("decrby")
+				return
+			}
+			n, err := strconv.ParseInt(string(args[1]), 10, 64)
+			if err != nil {
+				c.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			c.incrBy(args[0], -n)
+		},
+		"CLUSTER": func(c *Conn, args [][]byte) {
+			if len(args) == 0 || strings.ToUpper(string(args[0])) != "SLOTS" {
+				c.WriteError("ERR unsupported CLUSTER subcommand")
+				return
+			}
+			shards := c.Srv.shards
+			if shards == nil {
+				shards = []*Server{c.Srv}
+			}
+			c.WriteArrayLen(len(shards))
+			for i, shard := range shards {
+				host, port, _ := net.SplitHostPort(shard.Addr())
+				p, _ := strconv.Atoi(port)
+				c.WriteArrayLen(3)
+				c.WriteInt(int64(i * 16384 / len(shards)))
+				c.WriteInt(int64((i+1)*16384/len(shards) - 1))
+				c.WriteArrayLen(3)
+				c.WriteBulk([]byte(host))
+				c.WriteInt(int64(p))
+				c.WriteBulk([]byte(fmt.Sprintf("fake-node-%d", i)))
+			}
+		},
+		"SCAN": func(c *Conn, args [][]byte) {
+			if len(args) < 1 {
+				c.WriteArgErr("scan")
+				return
+			}
+			cursor, err := strconv.Atoi(string(args[0]))
+			if err != nil {
+				c.WriteError("ERR invalid cursor")
+				return
+			}
+			match, count := "*", 10
+			for i := 1; i+1 < len(args); i += 2 {
+				switch strings.ToUpper(string(args[i])) {
+				case "MATCH":
+					match = string(args[i+1])
+				case "COUNT":
+					count, _ = strconv.Atoi(string(args[i+1]))
+				}
+			}
+			// a scan works on a sorted snapshot of the keys taken by its first
+			// call, so keys deleted mid-scan don't cause others to be
+			// skipped, and keys added mid-scan may be missed, as with redis
+			keys, ok := c.Srv.cursors[cursor]
+			if cursor == 0 {
+				keys = make([]string, 0, len(c.Srv.data))
+				for k := range c.Srv.data {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+			} else if !ok {
+				c.WriteError("ERR invalid cursor")
+				return
+			}
+			delete(c.Srv.cursors, cursor)
+			var found [][]byte
+			i := 0
+			for ; i < len(keys) && i < count; i++ {
+				if c.Srv.Lookup(keys[i]) != nil && globMatch(match, keys[i]) {
+					found = append(found, []byte(keys[i]))
+				}
+			}
+			next := 0
+			if i < len(keys) {
+				c.Srv.nextCursor++
+				next = c.Srv.nextCursor
+				c.Srv.cursors[next] = keys[i:]
+			}
+			c.WriteArrayLen(2)
+			c.WriteBulk([]byte(strconv.Itoa(next)))
+			c.WriteArrayLen(len(found))
+			for _, k := range found {
+				c.WriteBulk(k)
+			}
+		},
+		"EVAL": func(c *Conn, args [][]byte) {
+			if len(args) < 2 {
+				c.WriteArgErr("eval")
+				return
+			}
+			sum := sha1.Sum(args[0])
+			sha := hex.EncodeToString(sum[:])
+			c.Srv.loaded[sha] = true
+			c.runScript(sha, args[1:])
+		},
+		"EVALSHA": func(c *Conn, args [][]byte) {
+			if len(args) < 2 {
+				c.WriteArgErr("evalsha")
+				return
+			}
+			sha := strings.ToLower(string(args[0]))
+			if !c.Srv.loaded[sha] {
+				c.WriteError("NOSCRIPT No matching script. Please use EVAL.")
+				return
+			}
+			c.runScript(sha, args[1:])
+		},
+		"SCRIPT": func(c *Conn, args [][]byte) {
+			if len(args) < 2 || strings.ToUpper(string(args[0])) != "LOAD" {
+				c.WriteError("ERR unsupported SCRIPT subcommand")
+				return
+			}
+			sum := sha1.Sum(args[1])
+			sha := hex.EncodeToString(sum[:])
+			c.Srv.loaded[sha] = true
+			c.WriteBulk([]byte(sha))
+		},
+		"FUNCTION": func(c *Conn, args [][]byte) {
+			if len(args) < 2 || strings.ToUpper(string(args[0])) != "LOAD" {
+				c.WriteError("ERR unsupported FUNCTION subcommand")
+				return
+			}
+			replace := len(args) == 3 && strings.ToUpper(string(args[1])) == "REPLACE"
+			code := string(args[len(args)-1])
+			header := strings.SplitN(code, "\n", 2)[0]
+			if !strings.HasPrefix(header, "#!lua name=") {
+				c.WriteError("ERR Missing library metadata")
+				return
+			}
+			name := strings.TrimPrefix(header, "#!lua name=")
+			if c.Srv.libraries[name] && !replace {
+				c.WriteError(fmt.Sprintf("ERR Library '%s' already exists", name))
+				return
+			}
+			c.Srv.libraries[name] = true
+			c.WriteBulk([]byte(name))
+		},
+		"FCALL":    fcall,
+		"FCALL_RO": fcall,
+		"LPUSH": func(c *Conn, args [][]byte) {
+			if len(args) < 2 {
+				c.WriteArgErr("lpush")
+				return
+			}
+			key := string(args[0])
+			v := c.Srv.Lookup(key)
+			if v == nil {
+				v = &Value{IsList: true}
+				c.Srv.data[key] = v
+			} else if !v.IsList {
+				c.WriteWrongType()
+				return
+			}
+			for _, e := range args[1:] {
+				v.List = append([][]byte{append([]byte(nil), e...)}, v.List...)
+			}
+			c.WriteInt(int64(len(v.List)))
+		},
+		"LTRIM": func(c *Conn, args [][]byte) {
+			if len(args) != 3 {
+				c.WriteArgErr("ltrim")
+				return
+			}
+			key := string(args[0])
+			v := c.Srv.Lookup(key)
+			if v != nil && !v.IsList {
+				c.WriteWrongType()
+				return
+			}
+			if v != nil {
+				start, stop := listRange(args[1], args[2], len(v.List))
+				if start > stop {
+					delete(c.Srv.data, key)
+				} else {
+					v.List = v.List[start : stop+1]
+				}
+			}
+			c.WriteStatus("OK")
+		},
+		"LRANGE": func(c *Conn, args [][]byte) {
+			if len(args) != 3 {
+				c.WriteArgErr("lrange")
+				return
+			}
+			v := c.Srv.Lookup(string(args[0]))
+			if v == nil {
+				c.WriteArrayLen(0)
+				return
+			}
+			if !v.IsList {
+				c.WriteWrongType()
+				return
+			}
+			start, stop := listRange(args[1], args[2], len(v.List))
+			if start > stop {
+				c.WriteArrayLen(0)
+				return
+			}
+			c.WriteArrayLen(stop - start + 1)
+			for _, e := range v.List[start : stop+1] {
+				c.WriteBulk(e)
+			}
+		},
+		"EXPIRE": func(c *Conn, args [][]byte) {
+			if len(args) < 2 {
+				c.WriteArgErr("expire")
+				return
+			}
+			v := c.Srv.Lookup(string(args[0]))
+			n, err := strconv.ParseInt(string(args[1]), 10, 64)
+			if err != nil {
+				c.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			if v == nil {
+				c.WriteInt(0)
+				return
+			}
+			v.ExpireAt = c.Srv.now().Add(time.Duration(n) * time.Second)
+			c.WriteInt(1)
+		},
+		"EXISTS": func(c *Conn, args [][]byte) {
+			if len(args) == 0 {
+				c.WriteArgErr("exists")
+				return
+			}
+			var n int64
+			for _, k := range args {
+				if c.Srv.Lookup(string(k)) != nil {
+					n++
+				}
+			}
+			c.WriteInt(n)
+		},
+		"STRLEN": func(c *Conn, args [][]byte) {
+			if len(args) != 1 {
+				c.WriteArgErr("strlen")
+				return
+			}
+			v := c.Srv.Lookup(string(args[0]))
+			if v == nil {
+				c.WriteInt(0)
+				return
+			}
+			c.WriteInt(int64(len(v.Str)))
+		},
+		"MEMORY": func(c *Conn, args [][]byte) {
+			if len(args) != 2 || strings.ToUpper(string(args[0])) != "USAGE" {
+				c.WriteError("ERR unsupported MEMORY subcommand")
+				return
+			}
+			v := c.Srv.Lookup(string(args[1]))
+			if v == nil {
+				c.WriteNil()
+				return
+			}
+			// a rough stand-in for the allocator's accounting: the key, the
+			// value and a fixed overhead per key
+			n := int64(memoryOverhead + len(args[1]) + len(v.Str))
+			for _, e := range v.List {
+				n += int64(len(e))
+			}
+			c.WriteInt(n)
+		},
+		"RENAME": func(c *Conn, args [][]byte) {
+			if len(args) != 2 {
+				c.WriteArgErr("rename")
+				return
+			}
+			if c.crossSlot(args) {
+				return
+			}
+			v := c.Srv.Lookup(string(args[0]))
+			if v == nil {
+				c.WriteError("ERR no such key")
+				return
+			}
+			delete(c.Srv.data, string(args[0]))
+			c.Srv.data[string(args[1])] = v
+			c.Srv.notifyKeyspace(string(args[0]), "rename_from")
+			c.Srv.notifyKeyspace(string(args[1]), "rename_to")
+			c.WriteStatus("OK")
+		},
+		"DEL": func(c *Conn, args [][]byte) {
+			if c.crossSlot(args) {
+				return
+			}
+			var n int64
+			for _, k := range args {
+				if c.Srv.Lookup(string(k)) != nil {
+					c.Srv.Delete(string(k))
+					n++
+				}
+			}
+			c.WriteInt(n)
+		},
+	}
+}
+
+// New starts a fake server that is closed when the test finishes.
+func New(t testing.TB) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &Server{
+		ln:        ln,
+		dbs:       map[int]map[string]*Value{},
+		cmds:      map[string]int{},
+		loaded:    map[string]bool{},
+		libraries: map[string]bool{},
+		cursors:   map[int][]string{},
+		disabled:  map[string]bool{},
+		subs:      map[string]map[*Conn]bool{},
+		conns:     map[net.Conn]bool{},
+	}
+	f.selectDB(0)
+	go f.serve()
+	t.Cleanup(f.Close)
+	return f
+}
+
+// Addr returns the address the server listens on.
+func (f *Server) Addr() string {
+	return f.ln.Addr().String()
+}
+
+// Close stops accepting connections and closes the open ones, so that
+// clients see the server as down.
+func (f *Server) Close() {
+	f.ln.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for nc := range f.conns {
+		nc.Close()
+	}
+}
+
+// Client returns a new go-redis client connected to the fake server.
+func (f *Server) Client(t testing.TB) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: f.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// ClusterClient returns a go-redis cluster client whose single node is the
+// fake server, which reports itself as owning every slot.
+//
+// From then on the server rejects multi-key commands whose keys hash to
+// different slots with CROSSSLOT, as a cluster node does.
+func (f *Server) ClusterClient(t testing.TB) *redis.ClusterClient {
+	f.mu.Lock()
+	f.cluster = true
+	f.mu.Unlock()
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{f.Addr()}})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// NewCluster starts n fake servers forming a cluster, each owning an equal
+// range of slots in order. The servers reject multi-key commands whose keys
+// hash to different slots like ClusterClient, but don't check that keys belong
+// to their own slots.
+func NewCluster(t testing.TB, n int) []*Server {
+	shards := make([]*Server, n)
+	for i := range shards {
+		shards[i] = New(t)
+	}
+	for _, f := range shards {
+		f.mu.Lock()
+		f.cluster = true
+		f.shards = shards
+		f.mu.Unlock()
+	}
+	return shards
+}
+
+// transactionCommands are the commands run at once rather than queued inside
+// a MULTI transaction.
+var transactionCommands = map[string]bool{"MULTI": true, "EXEC": true, "DISCARD": true}
+
+// discoveryCommands are the commands clients send to set up a connection and
+// discover the cluster topology, which SetLatency doesn't delay.
+var discoveryCommands = map[string]bool{"HELLO": true, "COMMAND": true, "CLUSTER": true}
+
+// SetLatency delays the reply to every later command by d, except those in
+// discoveryCommands, so clients still connect and discover the topology
+// promptly.
+func (f *Server) SetLatency(d time.Duration) {
+	f.latency.Store(int64(d))
+}
+
+// Disable makes the server reply to the command name as to an unknown one, as
+// older Redis versions do for newer commands.
+func (f *Server) Disable(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.disabled[strings.ToUpper(name)] = true
+}
+
+// FastForward advances the server clock used for key expiry.
+func (f *Server) FastForward(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.skew += d
+}
+
+func (f *Server) now() time.Time {
+	return time.Now().Add(f.skew)
+}
+
+// SetString stores a string value at key, expiring after ttl if positive. The
+// caller must hold f.mu.
+func (f *Server) SetString(key string, value []byte, ttl time.Duration) {
+	v := &Value{Str: append([]byte(nil), value...)}
+	if ttl > 0 {
+		v.ExpireAt = f.now().Add(ttl)
+	}
+	f.data[key] = v
+	f.notifyKeyspace(key, "set")
+}
+
+// Lookup returns the live value at key, evicting it if it has expired. The
+// caller must hold f.mu.
+func (f *Server) Lookup(key string) *Value {
+	v, ok := f.data[key]
+	if !ok {
+		return nil
+	}
+	if !v.ExpireAt.IsZero() && !f.now().Before(v.ExpireAt) {
+		delete(f.data, key)
+		return nil
+	}
+	return v
+}
+
+// Delete removes key. The caller must hold f.mu.
+func (f *Server) Delete(key string) {
+	delete(f.data, key)
+	f.notifyKeyspace(key, "del")
+}
+
+// EnableKeyspaceNotifications makes the server publish an event on
+// __keyspace@0__:<key> whenever a string key is set or a key is deleted, as
+// notify-keyspace-events "Kg$" does.
+func (f *Server) EnableKeyspaceNotifications() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notify = true
+}
+
+// Subscribers returns the number of connections subscribed to channel.
+func (f *Server) Subscribers(channel string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs[channel])
+}
+
+func (f *Server) notifyKeyspace(key, event string) {
+	if f.notify {
+		f.publish(fmt.Sprintf("__keyspace@%d__:%s", f.db, key), []byte(event))
+	}
+}
+
+// selectDB makes db the keyspace commands operate on. The caller must hold
+// f.mu.
+func (f *Server) selectDB(db int) {
+	if f.dbs[db] == nil {
+		f.dbs[db] = map[string]*Value{}
+	}
+	f.db = db
+	f.data = f.dbs[db]
+}
+
+// KeysIn returns every key currently stored in database db.
+func (f *Server) KeysIn(db int) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.selectDB(db)
+	defer f.selectDB(0)
+	keys := make([]string, 0, len(f.data))
+	for k := range f.data {
+		if f.Lookup(k) != nil {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// publish delivers msg to the subscribers of channel. The caller must hold
+// f.mu.
+func (f *Server) publish(channel string, msg []byte) int {
+	for sub := range f.subs[channel] {
+		sub.WriteArrayLen(3)
+		sub.WriteBulk([]byte("message"))
+		sub.WriteBulk([]byte(channel))
+		sub.WriteBulk(msg)
+		sub.w.Flush()
+	}
+	return len(f.subs[channel])
+}
+
+// Count returns how many times the named command was received.
+func (f *Server) Count(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cmds[strings.ToUpper(name)]
+}
+
+// Raw returns the value stored at key, bypassing the store.
+func (f *Server) Raw(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v := f.Lookup(key)
+	if v == nil {
+		return nil, false
+	}
+	return v.Str, true
+}
+
+// SetRaw writes a value at key, bypassing the store.
+func (f *Server) SetRaw(key string, value []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[key] = &Value{Str: value}
+}
+
+// Keys returns every key currently stored in database 0.
+func (f *Server) Keys() []string {
+	return f.KeysIn(0)
+}
+
+func (f *Server) serve() {
+	for {
+		nc, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(nc)
+	}
+}
+
+func (f *Server) handle(nc net.Conn) {
+	f.mu.Lock()
+	f.conns[nc] = true
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.conns, nc)
+		f.mu.Unlock()
+		nc.Close()
+	}()
+	r := bufio.NewReader(nc)
+	c := &Conn{Srv: f, w: bufio.NewWriter(nc)}
+	defer func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for ch := range c.channels {
+			c.unsubscribe(ch)
+		}
+	}()
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.ToUpper(string(args[0]))
+		if d := f.latency.Load(); d > 0 && !discoveryCommands[name] {
+			time.Sleep(time.Duration(d))
+		}
+		f.mu.Lock()
+		f.cmds[name]++
+		f.selectDB(c.db)
+		h, ok := commands[name]
+		switch {
+		case !ok || f.disabled[name]:
+			c.WriteError(fmt.Sprintf("ERR unknown command '%s'", name))
+			if c.queued != nil {
+				c.aborted = true
+			}
+		case c.queued != nil && !transactionCommands[name]:
+			c.queued = append(c.queued, args)
+			c.WriteStatus("QUEUED")
+		default:
+			h(c, args[1:])
+		}
+		// the exported accessors work on database 0
+		f.selectDB(0)
+		// flush under the lock, as publish may write to c concurrently
+		if r.Buffered() == 0 {
+			err = c.w.Flush()
+		}
+		f.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// globMatch reports whether s matches the redis glob pattern, supporting '*',
+// '?' and backslash escapes.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// listRange resolves redis LRANGE style indexes, which may be negative, into a
+// clamped inclusive range over a list of length n.
+func listRange(startArg, stopArg []byte, n int) (int, int) {
+	start, _ := strconv.Atoi(string(startArg))
+	stop, _ := strconv.Atoi(string(stopArg))
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	return start, stop
+}
+
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return nil, errors.New("fake redis: expected array")
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([][]byte, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errors.New("fake redis: expected bulk string")
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = buf[:size]
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *Conn) incrBy(key []byte, delta int64) {
+	var n int64
+	if v := c.Srv.Lookup(string(key)); v != nil {
+		if v.IsList {
+			c.WriteWrongType()
+			return
+		}
+		var err error
+		if n, err = strconv.ParseInt(string(v.Str), 10, 64); err != nil {
+			c.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+	}
+	n += delta
+	v := c.Srv.Lookup(string(key))
+	if v == nil {
+		v = &Value{}
+		c.Srv.data[string(key)] = v
+	}
+	v.Str = strconv.AppendInt(nil, n, 10)
+	c.Srv.notifyKeyspace(string(key), "incrby")
+	c.WriteInt(n)
+}
+
+func (c *Conn) subscribe(ch string) {
+	if c.channels == nil {
+		c.channels = map[string]bool{}
+	}
+	c.channels[ch] = true
+	if c.Srv.subs[ch] == nil {
+		c.Srv.subs[ch] = map[*Conn]bool{}
+	}
+	c.Srv.subs[ch][c] = true
+}
+
+func (c *Conn) unsubscribe(ch string) {
+	delete(c.channels, ch)
+	delete(c.Srv.subs[ch], c)
+	if len(c.Srv.subs[ch]) == 0 {
+		delete(c.Srv.subs, ch)
+	}
+}
+
+func (c *Conn) writeSubscription(kind string, ch []byte) {
+	c.WriteArrayLen(3)
+	c.WriteBulk([]byte(kind))
+	if ch == nil {
+		c.WriteNil()
+	} else {
+		c.WriteBulk(ch)
+	}
+	c.WriteInt(int64(len(c.channels)))
+}
+
+// crossSlot replies with a CROSSSLOT error and returns true if the server acts
+// as a cluster node and keys don't all hash to the same slot.
+func (c *Conn) crossSlot(keys [][]byte) bool {
+	if !c.Srv.cluster || len(keys) < 2 {
+		return false
+	}
+	slot := KeySlot(string(keys[0]))
+	for _, k := range keys[1:] {
+		if KeySlot(string(k)) != slot {
+			c.WriteError("CROSSSLOT Keys in request don't hash to the same slot")
+			return true
+		}
+	}
+	return false
+}
+
+// KeySlot returns the Redis Cluster hash slot of key, honouring hash tags.
+func KeySlot(key string) int {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			key = key[i+1 : i+1+j]
+		}
+	}
+	return int(crc16(key) % 16384)
+}
+
+// crc16 is the CRC16-CCITT (XMODEM) checksum Redis Cluster uses for slots.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// fcall runs a function registered with RegisterFunction, for FCALL and
+// FCALL_RO.
+func fcall(c *Conn, args [][]byte) {
+	if len(args) < 2 {
+		c.WriteArgErr("fcall")
+		return
+	}
+	f, ok := functions[string(args[0])]
+	if !ok || !c.Srv.libraries[f.library] {
+		c.WriteError("ERR Function not found")
+		return
+	}
+	numKeys, err := strconv.Atoi(string(args[1]))
+	if err != nil || numKeys < 0 || numKeys > len(args)-2 {
+		c.WriteError("ERR Number of keys can't be greater than number of args")
+		return
+	}
+	if c.crossSlot(args[2 : 2+numKeys]) {
+		return
+	}
+	f.fn(c, args[2:2+numKeys], args[2+numKeys:])
+}
+
+func (c *Conn) runScript(sha string, args [][]byte) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys < 0 || numKeys > len(args)-1 {
+		c.WriteError("ERR Number of keys can't be greater than number of args")
+		return
+	}
+	if c.crossSlot(args[1 : 1+numKeys]) {
+		return
+	}
+	script, ok := scripts[sha]
+	if !ok {
+		c.WriteError("ERR fake redis: no emulation for script " + sha)
+		return
+	}
+	script(c, args[1:1+numKeys], args[1+numKeys:])
+}
+
+func (c *Conn) WriteStatus(s string) {
+	c.w.WriteString("+" + s + "\r\n")
+}
+
+func (c *Conn) WriteError(s string) {
+	c.w.WriteString("-" + s + "\r\n")
+}
+
+func (c *Conn) WriteArgErr(name string) {
+	c.WriteError("ERR wrong number of arguments for '" + name + "' command")
+}
+
+func (c *Conn) WriteWrongType() {
+	c.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func (c *Conn) WriteInt(n int64) {
+	c.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (c *Conn) WriteNil() {
+	c.w.WriteString("$-1\r\n")
+}
+
+func (c *Conn) WriteBulk(b []byte) {
+	c.w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	c.w.Write(b)
+	c.w.WriteString("\r\n")
+}
+
+func (c *Conn) WriteArrayLen(n int) {
+	c.w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
@@ -0,0 +1,129 @@
+package merkleredis
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// nodeTypeNames are the JSON names of the node types.
+var nodeTypeNames = map[byte]string{
+	byte(merkletree.NodeTypeMiddle): "middle",
+	byte(merkletree.NodeTypeLeaf):   "leaf",
+	byte(merkletree.NodeTypeEmpty):  "empty",
+}
+
+type nodeItemJSON struct {
+	Type   string  `json:"type"`
+	Key    *string `json:"key,omitempty"`
+	ChildL *string `json:"childL,omitempty"`
+	ChildR *string `json:"childR,omitempty"`
+	Entry  *string `json:"entry,omitempty"`
+	Meta   *string `json:"meta,omitempty"`
+}
+
+// MarshalJSON renders the item with its byte fields hex encoded and its type by
+// name, or as a decimal string for types this package doesn't know. Nil fields
+// are omitted.
+func (item NodeItem) MarshalJSON() ([]byte, error) {
+	typ, ok := nodeTypeNames[item.Type]
+	if !ok {
+		typ = strconv.Itoa(int(item.Type))
+	}
+	return json.Marshal(nodeItemJSON{
+		Type:   typ,
+		Key:    hexOrNil(item.Key),
+		ChildL: hexOrNil(item.ChildL),
+		ChildR: hexOrNil(item.ChildR),
+		Entry:  hexOrNil(item.Entry),
+		Meta:   hexOrNil(item.Meta),
+	})
+}
+
+// UnmarshalJSON parses the format written by MarshalJSON.
+func (item *NodeItem) UnmarshalJSON(d []byte) error {
+	var j nodeItemJSON
+	if err := json.Unmarshal(d, &j); err != nil {
+		return err
+	}
+	typ, err := parseNodeType(j.Type)
+	if err != nil {
+		return err
+	}
+	var n NodeItem
+	n.Type = typ
+	for _, f := range []struct {
+		name string
+		src  *string
+		dst  *[]byte
+	}{
+		{"key", j.Key, &n.Key},
+		{"childL", j.ChildL, &n.ChildL},
+		{"childR", j.ChildR, &n.ChildR},
+		{"entry", j.Entry, &n.Entry},
+		{"meta", j.Meta, &n.Meta},
+	} {
+		if f.src == nil {
+			continue
+		}
+		b, err := hex.DecodeString(*f.src)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", f.name, err)
+		}
+		*f.dst = b
+	}
+	*item = n
+	return nil
+}
+
+func parseNodeType(s string) (byte, error) {
+	for t, name := range nodeTypeNames {
+		if s == name {
+			return t, nil
+		}
+	}
+	t, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid node type %q", s)
+	}
+	return byte(t), nil
+}
+
+type rootItemJSON struct {
+	MTId uint64  `json:"mtId"`
+	Key  *string `json:"key,omitempty"`
+}
+
+// MarshalJSON renders the item with its key hex encoded.
+func (item RootItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rootItemJSON{MTId: item.MTId, Key: hexOrNil(item.Key)})
+}
+
+// UnmarshalJSON parses the format written by MarshalJSON.
+func (item *RootItem) UnmarshalJSON(d []byte) error {
+	var j rootItemJSON
+	if err := json.Unmarshal(d, &j); err != nil {
+		return err
+	}
+	r := RootItem{MTId: j.MTId}
+	if j.Key != nil {
+		b, err := hex.DecodeString(*j.Key)
+		if err != nil {
+			return fmt.Errorf("invalid key: %w", err)
+		}
+		r.Key = b
+	}
+	*item = r
+	return nil
+}
+
+func hexOrNil(b []byte) *string {
+	if b == nil {
+		return nil
+	}
+	s := hex.EncodeToString(b)
+	return &s
+}
@@ -0,0 +1,90 @@
+package merkleredis
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestNodeItemJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		node *merkletree.Node
+	}{
+		{"empty", merkletree.NewNodeEmpty()},
+		{"leaf", merkletree.NewNodeLeaf(testHash(1), testHash(2))},
+		{"middle", merkletree.NewNodeMiddle(testHash(3), testHash(4))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			item, err := NewNodeItemFromNode([]byte{0xab, 0xcd}, tc.node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := json.Marshal(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(d), `"type":"`+tc.name+`"`) || !strings.Contains(string(d), `"key":"abcd"`) {
+				t.Fatalf("unexpected JSON %s", d)
+			}
+			var got NodeItem
+			if err := json.Unmarshal(d, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Type != item.Type || !bytes.Equal(got.Key, item.Key) ||
+				!bytes.Equal(got.ChildL, item.ChildL) || !bytes.Equal(got.ChildR, item.ChildR) ||
+				!bytes.Equal(got.Entry, item.Entry) {
+				t.Fatalf("got %+v, want %+v", got, item)
+			}
+			for _, f := range [][2][]byte{{got.ChildL, item.ChildL}, {got.ChildR, item.ChildR}, {got.Entry, item.Entry}} {
+				if (f[0] == nil) != (f[1] == nil) {
+					t.Fatalf("nil field not preserved: got %+v, want %+v", got, item)
+				}
+			}
+		})
+	}
+
+	meta, err := json.Marshal(NodeItem{Type: 1, Meta: []byte{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var withMeta NodeItem
+	if err := json.Unmarshal(meta, &withMeta); err != nil || !bytes.Equal(withMeta.Meta, []byte{1, 2}) {
+		t.Fatalf("metadata: got %s -> %+v, %v", meta, withMeta, err)
+	}
+
+	var item NodeItem
+	if err := json.Unmarshal([]byte(`{"type":"7","key":""}`), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Type != 7 || item.Key == nil || len(item.Key) != 0 {
+		t.Fatalf("got %+v", item)
+	}
+	if err := json.Unmarshal([]byte(`{"type":"bogus"}`), &item); err == nil {
+		t.Fatal("invalid type: got nil error")
+	}
+	if err := json.Unmarshal([]byte(`{"type":"leaf","entry":"zz"}`), &item); err == nil {
+		t.Fatal("invalid hex: got nil error")
+	}
+}
+
+func TestRootItemJSON(t *testing.T) {
+	item := RootItem{MTId: 42, Key: testHash(9)[:]}
+	d, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"mtId":42,"key":"` + strings.Repeat("09", 32) + `"}`; string(d) != want {
+		t.Fatalf("got %s, want %s", d, want)
+	}
+	var got RootItem
+	if err := json.Unmarshal(d, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.MTId != item.MTId || !bytes.Equal(got.Key, item.Key) {
+		t.Fatalf("got %+v, want %+v", got, item)
+	}
+}
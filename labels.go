@@ -0,0 +1,72 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// labeledRootInfix separates the root key of a tree from the label of a
+// labeled root, see SetLabeledRoot. It holds "#", which ValidatePrefix rejects
+// in prefixes and separators, so the labeled roots of a tree can't be mistaken
+// for the keys of a tree derived from it.
+const labeledRootInfix = "#l#"
+
+// ErrEmptyLabel is returned by SetLabeledRoot and GetLabeledRoot for an empty
+// label.
+var ErrEmptyLabel = errors.New("empty root label")
+
+// labeledRootId returns the key of the root labeled label.
+func (s *Storage) labeledRootId(label string) string {
+	return s.rootId + labeledRootInfix + label
+}
+
+// SetLabeledRoot stores hash as the root named label, for example the block
+// height of a checkpoint, so that the tree as of then can be opened later. It
+// doesn't change the current root, and GetRoot and SetRoot don't see labeled
+// roots. Like SetRoot it applies the store's TTL and WithStrictSetRoot, but
+// labeled roots aren't recorded in the root history.
+func (s *Storage) SetLabeledRoot(ctx context.Context, label string, hash *merkletree.Hash) error {
+	if label == "" {
+		return ErrEmptyLabel
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if err := s.checkRootNode(ctx, hash); err != nil {
+		return err
+	}
+	v, err := s.encodeRoot(hash)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Set(ctx, s.labeledRootId(label), v, s.ttl).Err(); err != nil {
+		return newErr(err, "failed to set labeled root")
+	}
+	return nil
+}
+
+// GetLabeledRoot returns the root stored by SetLabeledRoot under label, or
+// ErrRootNotFound if there is none.
+func (s *Storage) GetLabeledRoot(ctx context.Context, label string) (*merkletree.Hash, error) {
+	if label == "" {
+		return nil, ErrEmptyLabel
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	id := s.labeledRootId(label)
+	v, err := s.reader().Get(ctx, id).Result()
+	if err == redis.Nil {
+		return nil, ErrRootNotFound
+	} else if err != nil {
+		return nil, newErr(err, "failed to read labeled root")
+	}
+	var root merkletree.Hash
+	if err := s.decodeRoot(id, v, &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
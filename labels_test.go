@@ -0,0 +1,103 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestLabeledRoots(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "labeled")
+
+	if err := s.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetLabeledRoot(ctx, "100", testHash(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetLabeledRoot(ctx, "200", testHash(3)); err != nil {
+		t.Fatal(err)
+	}
+	for label, want := range map[string]byte{"100": 2, "200": 3} {
+		root, err := s.GetLabeledRoot(ctx, label)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *root != *testHash(want) {
+			t.Fatalf("root %s: got %x, want %x", label, root[:], testHash(want)[:])
+		}
+	}
+	// the current root is independent, also when read back from Redis
+	checkRoot(t, s, testHash(1))
+	checkRoot(t, NewMerkleRedisStorage(srv.Client(t), "labeled"), testHash(1))
+	if _, ok := srv.Raw(s.labeledRootId("100")); !ok {
+		t.Fatal("labeled root not stored under its key")
+	}
+
+	if _, err := s.GetLabeledRoot(ctx, "300"); !errors.Is(err, ErrRootNotFound) {
+		t.Fatalf("missing label: got %v, want ErrRootNotFound", err)
+	}
+	if err := s.SetLabeledRoot(ctx, "", testHash(4)); err != ErrEmptyLabel {
+		t.Fatalf("empty label: got %v, want ErrEmptyLabel", err)
+	}
+
+	// labeled roots belong to the tree they were set on
+	if trees, err := ListTrees(ctx, srv.Client(t)); err != nil || !reflect.DeepEqual(trees, []string{"labeled"}) {
+		t.Fatalf("ListTrees: got %q, %v", trees, err)
+	}
+	if err := s.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if keys := srv.Keys(); len(keys) != 0 {
+		t.Fatalf("Clear left %v", keys)
+	}
+}
+
+func TestLabeledRootsOfDerivedTree(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "p")
+	// the derived tree "l" must not be taken for labeled roots of s
+	child := s.WithPrefix("l")
+	newTestTree(t, child, 3)
+	childKeys := len(srv.Keys())
+	mt := newTestTree(t, s, 3)
+	if err := s.SetLabeledRoot(ctx, "meta", mt.Root()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GC(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Keys()); n != childKeys {
+		t.Fatalf("%d keys left, want the %d of the derived tree", n, childKeys)
+	}
+	for _, suffix := range []string{rootTimestampSuffix, versionSuffix, formatSuffix} {
+		if _, ok := srv.Raw(child.rootId + suffix); !ok {
+			t.Fatalf("Clear removed %s of the derived tree", child.rootId+suffix)
+		}
+	}
+}
+
+func TestLabeledRootStrict(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "labeled", WithStrictSetRoot(true))
+
+	if err := s.SetLabeledRoot(ctx, "1", testHash(2)); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("strict SetLabeledRoot of a dangling root: got %v, want ErrNotFound", err)
+	}
+	if _, ok := srv.Raw(s.labeledRootId("1")); ok {
+		t.Fatal("dangling labeled root was stored")
+	}
+	if err := s.SetLabeledRoot(ctx, "1", &merkletree.HashZero); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,61 @@
+package merkleredis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// lockSuffix is appended to the root key to form the tree lock key.
+const lockSuffix = "_lock"
+
+// ErrLocked is returned by Lock when another holder has the tree lock.
+var ErrLocked = errors.New("merkle tree is locked")
+
+// unlockScript deletes the lock in KEYS[1] only if it still holds the token in
+// ARGV[1], so a holder whose lock expired can't release someone else's.
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Lock takes an exclusive lock on the tree, held until unlock is called or ttl
+// elapses, and returns ErrLocked if it is already held. Writers sharing a tree
+// should hold the lock around each read-modify-write cycle (GetRoot, the
+// updates, SetRoot) so their updates don't clobber each other.
+//
+// The lock is advisory: the store's own methods don't check it.
+func (s *Storage) Lock(ctx context.Context, ttl time.Duration) (unlock func() error, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(b[:])
+	key := s.rootId + lockSuffix
+
+	ok, err := s.db.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, newErr(err, "failed to acquire tree lock")
+	}
+	if !ok {
+		return nil, ErrLocked
+	}
+	return func() error {
+		// unlock may be deferred after ctx is done, so don't tie it to ctx
+		ctx, cancel := s.withTimeout(context.Background())
+		defer cancel()
+		if err := unlockScript.Run(ctx, s.db, []string{key}, token).Err(); err != nil {
+			return newErr(err, "failed to release tree lock")
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,69 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+)
+
+func init() {
+	fakeredis.RegisterScript(unlockScript.Hash(), func(c *fakeredis.Conn, keys, argv [][]byte) {
+		v := c.Srv.Lookup(string(keys[0]))
+		if v == nil || !bytes.Equal(v.Str, argv[0]) {
+			c.WriteInt(0)
+			return
+		}
+		c.Srv.Delete(string(keys[0]))
+		c.WriteInt(1)
+	})
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	a := NewMerkleRedisStorage(srv.Client(t), "lock")
+	b := NewMerkleRedisStorage(srv.Client(t), "lock")
+
+	unlock, err := a.Lock(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Lock(ctx, time.Minute); err != ErrLocked {
+		t.Fatalf("second Lock: got %v, want ErrLocked", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	unlockB, err := b.Lock(ctx, time.Minute)
+	if err != nil {
+		t.Fatalf("Lock after unlock: %v", err)
+	}
+
+	// a stale unlock must not release b's lock
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Lock(ctx, time.Minute); err != ErrLocked {
+		t.Fatalf("stale unlock released the lock: %v", err)
+	}
+	if err := unlockB(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockExpires(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "lock")
+
+	if _, err := s.Lock(ctx, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	srv.FastForward(2 * time.Second)
+	if _, err := s.Lock(ctx, time.Second); err != nil {
+		t.Fatalf("Lock after expiry: %v", err)
+	}
+}
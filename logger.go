@@ -0,0 +1,30 @@
+package merkleredis
+
+// Logger receives warnings about recoverable problems the store works around,
+// such as a corrupt node skipped by List, and errors it has no caller to
+// return to, such as those of asynchronous writes. The methods take
+// fmt.Printf style arguments.
+type Logger interface {
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// WithLogger sets the Logger the store reports to. By default nothing is
+// reported.
+func WithLogger(l Logger) Option {
+	return func(s *Storage) {
+		s.logger = l
+	}
+}
+
+func (s *Storage) warnf(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Warnf(format, args...)
+	}
+}
+
+func (s *Storage) errorf(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Errorf(format, args...)
+	}
+}
@@ -0,0 +1,120 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+)
+
+// recordingLogger records the messages it receives.
+type recordingLogger struct {
+	mu       sync.Mutex
+	warnings []string
+	errors   []string
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+// take returns the warnings and errors recorded so far and forgets them.
+func (l *recordingLogger) take() (warnings, errors []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	warnings, errors = l.warnings, l.errors
+	l.warnings, l.errors = nil, nil
+	return warnings, errors
+}
+
+func TestLoggerCorruptNode(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	l := &recordingLogger{}
+	s := NewMerkleRedisStorage(srv.Client(t), "logger", WithLogger(l))
+
+	mt := newTestTree(t, s, 10)
+	root, err := s.Get(ctx, mt.Root()[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := s.getRedisNodeIdForMerkleKey(root.ChildR[:])
+	srv.SetRaw(corrupt, []byte("garbage"))
+	n, err := s.NodeCount(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkWarning := func(name string) {
+		t.Helper()
+		warnings, errors := l.take()
+		if len(warnings) != 1 || !strings.Contains(warnings[0], corrupt) || len(errors) != 0 {
+			t.Fatalf("%s: got warnings %q and errors %q, want one warning about %s", name, warnings, errors, corrupt)
+		}
+	}
+
+	kvs, err := s.List(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(kvs)) != n-1 {
+		t.Fatalf("List: got %d nodes, want %d", len(kvs), n-1)
+	}
+	checkWarning("List")
+
+	var buf bytes.Buffer
+	if err := s.Export(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	checkWarning("Export")
+	dst, _ := newTestStorage(t, "logger_import")
+	if err := dst.Import(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := dst.NodeCount(ctx); err != nil || got != n-1 {
+		t.Fatalf("imported %d nodes, %v; want %d", got, err, n-1)
+	}
+
+	problems, err := s.VerifyIntegrity(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Kind != CorruptNode {
+		t.Fatalf("VerifyIntegrity: got %v", problems)
+	}
+	warnings, _ := l.take()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], fmt.Sprintf("%x", root.ChildR[:])) {
+		t.Fatalf("VerifyIntegrity: got warnings %q", warnings)
+	}
+}
+
+func TestLoggerAsyncError(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	l := &recordingLogger{}
+	s := NewMerkleRedisStorageUniversal(crashingClient{UniversalClient: srv.Client(t)}, "logger", WithAsyncWrites(8), WithLogger(l))
+	defer s.Close()
+
+	kvs := testLeafKVs(1)
+	if err := s.Put(ctx, kvs[0].K, &kvs[0].V); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(ctx); err == nil {
+		t.Fatal("Flush: got nil error")
+	}
+	if _, errors := l.take(); len(errors) != 1 || !strings.Contains(errors[0], errCrash.Error()) {
+		t.Fatalf("got errors %q, want one about the failed write", errors)
+	}
+}
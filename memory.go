@@ -0,0 +1,85 @@
+package merkleredis
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+var _ merkletree.Storage = (*MemoryStorage)(nil)
+
+// MemoryStorage implements the db.Storage interface in process memory, for
+// testing code built on Storage without Redis. Nodes are serialized with
+// MarshalNodeItem, as in Redis, so Get and Put behave like Storage's, including
+// their errors.
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	nodes map[string][]byte
+	root  *merkletree.Hash
+}
+
+// NewMemoryStorage returns an empty MemoryStorage. The prefix mirrors
+// NewMerkleRedisStorage and isn't used: every MemoryStorage holds a tree of its
+// own.
+func NewMemoryStorage(prefix string) *MemoryStorage {
+	return &MemoryStorage{nodes: map[string][]byte{}}
+}
+
+// Get retrieves the node stored under key, or ErrNodeNotFound.
+func (m *MemoryStorage) Get(ctx context.Context, key []byte) (*merkletree.Node, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+	m.mu.RLock()
+	d, ok := m.nodes[hex.EncodeToString(key)]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+	item, err := UnmarshalNodeItem(d)
+	if err != nil {
+		return nil, err
+	}
+	return item.Node()
+}
+
+// Put stores node under key.
+func (m *MemoryStorage) Put(ctx context.Context, key []byte, node *merkletree.Node) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	item, err := NewNodeItemFromNode(key, node)
+	if err != nil {
+		return err
+	}
+	d, err := MarshalNodeItem(item)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes[hex.EncodeToString(key)] = d
+	return nil
+}
+
+// GetRoot retrieves the root, or merkletree.ErrNotFound if none was set.
+func (m *MemoryStorage) GetRoot(ctx context.Context) (*merkletree.Hash, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.root == nil {
+		return nil, merkletree.ErrNotFound
+	}
+	root := *m.root
+	return &root, nil
+}
+
+// SetRoot stores hash as the root.
+func (m *MemoryStorage) SetRoot(ctx context.Context, hash *merkletree.Hash) error {
+	root := *hash
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.root = &root
+	return nil
+}
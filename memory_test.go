@@ -0,0 +1,117 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	testStorageSuite(t, func(t *testing.T) merkletree.Storage {
+		return NewMemoryStorage("suite")
+	})
+}
+
+func TestRedisStorageSuite(t *testing.T) {
+	testStorageSuite(t, func(t *testing.T) merkletree.Storage {
+		s, _ := newTestStorage(t, "suite")
+		return s
+	})
+}
+
+// testStorageSuite checks the db.Storage behaviour shared by every backend.
+func testStorageSuite(t *testing.T, newStorage func(t *testing.T) merkletree.Storage) {
+	ctx := context.Background()
+
+	t.Run("nodes", func(t *testing.T) {
+		s := newStorage(t)
+		if _, err := s.Get(ctx, []byte("absent")); !errors.Is(err, merkletree.ErrNotFound) {
+			t.Fatalf("Get of an absent node: got %v, want ErrNotFound", err)
+		}
+		for i, node := range []*merkletree.Node{
+			merkletree.NewNodeEmpty(),
+			merkletree.NewNodeLeaf(testHash(1), testHash(2)),
+			merkletree.NewNodeMiddle(testHash(3), testHash(4)),
+		} {
+			key := []byte{byte(i)}
+			if err := s.Put(ctx, key, node); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.Get(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Type != node.Type {
+				t.Fatalf("type: got %d, want %d", got.Type, node.Type)
+			}
+			want, _ := node.Key()
+			if h, _ := got.Key(); *h != *want {
+				t.Fatalf("node %d: got %+v, want %+v", i, got, node)
+			}
+		}
+
+		incomplete := &merkletree.Node{Type: merkletree.NodeTypeLeaf}
+		incomplete.Entry[0] = testHash(1)
+		if err := s.Put(ctx, []byte("bad"), incomplete); !errors.Is(err, merkletree.ErrNodeBytesBadSize) {
+			t.Fatalf("Put of an incomplete entry: got %v, want ErrNodeBytesBadSize", err)
+		}
+		if err := s.Put(ctx, nil, merkletree.NewNodeEmpty()); err != ErrEmptyKey {
+			t.Fatalf("Put of an empty key: got %v, want ErrEmptyKey", err)
+		}
+		if _, err := s.Get(ctx, []byte{}); err != ErrEmptyKey {
+			t.Fatalf("Get of an empty key: got %v, want ErrEmptyKey", err)
+		}
+	})
+
+	t.Run("root", func(t *testing.T) {
+		s := newStorage(t)
+		if _, err := s.GetRoot(ctx); !errors.Is(err, merkletree.ErrNotFound) {
+			t.Fatalf("GetRoot before SetRoot: got %v, want ErrNotFound", err)
+		}
+		for _, h := range []*merkletree.Hash{testHash(1), testHash(2)} {
+			if err := s.SetRoot(ctx, h); err != nil {
+				t.Fatal(err)
+			}
+			// the store must not alias the caller's hash
+			h[0] ^= 0xff
+			root, err := s.GetRoot(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h[0] ^= 0xff
+			if *root != *h {
+				t.Fatalf("root: got %x, want %x", root[:], h[:])
+			}
+		}
+	})
+
+	t.Run("tree", func(t *testing.T) {
+		s := newStorage(t)
+		mt, err := merkletree.NewMerkleTree(ctx, s, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := int64(0); i < 16; i++ {
+			if err := mt.Add(ctx, big.NewInt(i), big.NewInt(i+100)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		reopened, err := merkletree.NewMerkleTree(ctx, s, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *reopened.Root() != *mt.Root() {
+			t.Fatal("reopened tree has a different root")
+		}
+		_, v, _, err := reopened.Get(ctx, big.NewInt(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Int64() != 105 {
+			t.Fatalf("value of key 5: got %v, want 105", v)
+		}
+	})
+}
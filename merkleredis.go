@@ -2,8 +2,16 @@ package merkleredis
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-redis/redis/v9"
 	"github.com/iden3/go-merkletree-sql/v2"
@@ -12,13 +20,6 @@ import (
 const merkleTreeNodeBase = "mt_n_"
 const merkleTreeRootBase = "mt_r_"
 
-// TODO: upsert or insert?
-const upsertStmt = `INSERT INTO mt_nodes (mt_id, key, type, child_l, child_r, entry) VALUES ($1, $2, $3, $4, $5, $6) ` +
-	`ON CONFLICT (mt_id, key) DO UPDATE SET type = $3, child_l = $4, child_r = $5, entry = $6`
-
-const updateRootStmt = `INSERT INTO mt_roots (mt_id, key) VALUES ($1, $2) ` +
-	`ON CONFLICT (mt_id) DO UPDATE SET key = $2`
-
 func readUint32LE(d []byte, index int) uint32 {
 	return uint32(d[index+3])<<24 | uint32(d[index+2])<<16 | uint32(d[index+1])<<8 |
 		uint32(d[index])
@@ -29,22 +30,282 @@ func writeUint32LE(d []byte, index int, value uint32) {
 	d[index+2] = byte((value >> 16) & 0xff)
 	d[index+3] = byte((value >> 24) & 0xff)
 }
-func NewMerkleRedisStorage(client *redis.Client, prefix string) *Storage {
-	return &Storage{
-		db:           client,
-		nodeIdPrefix: merkleTreeNodeBase + prefix + "_",
-		rootId:       merkleTreeRootBase + prefix,
+
+// NewMerkleRedisStorage returns a Storage for the tree identified by prefix
+// on a single-node client.
+func NewMerkleRedisStorage(client *redis.Client, prefix string, opts ...Option) *Storage {
+	return NewMerkleRedisStorageUniversal(client, prefix, opts...)
+}
+
+// NewMerkleRedisStorageUniversal returns a Storage for the tree identified by
+// prefix on any client type (standalone, sentinel or cluster).
+func NewMerkleRedisStorageUniversal(client redis.UniversalClient, prefix string, opts ...Option) *Storage {
+	s := &Storage{
+		db:     client,
+		prefix: prefix,
+		opts:   opts,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.nodeIdPrefix, s.rootId = s.keyNames(prefix)
+	if s.ownsClient {
+		if s.readDb != nil {
+			s.closeClients = append(s.closeClients, s.readDb)
+		}
+		if s.secondary != nil {
+			s.closeClients = append(s.closeClients, s.secondary)
+		}
+		s.closeClients = append(s.closeClients, s.db)
+	}
+	if s.selectDatabase {
+		s.scopeDatabase()
+	}
+	if s.rootInvalidation.keyspace {
+		s.watchRoot()
+	}
+	if s.asyncBuffer > 0 {
+		s.async = newAsyncWriter(s, s.asyncBuffer)
+	}
+	return s
+}
+
+// NewMerkleRedisStorageWithID returns a Storage for the logical tree mtID
+// within the prefix namespace, so several trees can share one prefix as they
+// shared one set of SQL tables, see RootItem.MTId. Trees of different IDs, and
+// the tree of the prefix without an ID, are stored under distinct keys and
+// don't see each other, as long as no prefix holds "#", which ValidatePrefix
+// rejects. Stores derived with WithPrefix, Clone and Promote keep the ID.
+func NewMerkleRedisStorageWithID(client *redis.Client, prefix string, mtID uint64, opts ...Option) *Storage {
+	opts = append([]Option{withMTId(mtID)}, opts...)
+	return NewMerkleRedisStorage(client, prefix, opts...)
+}
+
+// withMTId scopes the keys of the store to the tree mtID, see
+// NewMerkleRedisStorageWithID.
+func withMTId(mtID uint64) Option {
+	return func(s *Storage) {
+		s.mtID = &mtID
 	}
 }
 
+// keyNames returns the node key prefix and the root key of the tree identified
+// by prefix and, if set, the store's tree ID. The ID follows a "#", which hex
+// node keys never hold and ValidatePrefix rejects in prefixes and separators,
+// so the keys of an ID can't collide with those of a valid prefix.
+func (s *Storage) keyNames(prefix string) (nodeIdPrefix, rootId string) {
+	if s.mtID != nil {
+		prefix += "#" + strconv.FormatUint(*s.mtID, 10)
+	}
+	if s.clusterHashTag {
+		prefix = "{" + prefix + "}"
+	}
+	return merkleTreeNodeBase + prefix + s.sep(), merkleTreeRootBase + prefix
+}
+
+// WithPrefix returns a Storage for the tree derived from this one by prefix,
+// stored with the prefix s.prefix+sep+prefix, where sep is the separator set
+// with WithSeparator, on the same client and with the same options. The derived
+// store never owns the client, doesn't use the write-ahead log set with WithWAL
+// and writes synchronously.
+func (s *Storage) WithPrefix(prefix string) *Storage {
+	opts := s.derivedOptions()
+	return NewMerkleRedisStorageUniversal(s.db, s.prefix+s.sep()+prefix, opts...)
+}
+
+// derivedOptions returns the options of the stores WithPrefix and Clone
+// derive from this one, which share its client but own neither it, its
+// write-ahead log nor an asynchronous writer.
+func (s *Storage) derivedOptions() []Option {
+	return append(append([]Option(nil), s.opts...), WithOwnedClient(false), func(d *Storage) {
+		d.wal = nil
+		d.asyncBuffer = 0
+	})
+}
+
+// NewMerkleRedisStorageChecked is like NewMerkleRedisStorage but validates
+// prefix with ValidatePrefix and the clients given to WithDatabase, pings the
+// server and checks the format version of the tree with CheckFormat first, so
+// that an invalid prefix or option, an unreachable or misconfigured Redis or
+// an incompatible tree is reported at startup instead of on the first tree
+// operation.
+func NewMerkleRedisStorageChecked(ctx context.Context, client *redis.Client, prefix string, opts ...Option) (*Storage, error) {
+	if err := ValidatePrefix(prefix, separatorOf(opts)); err != nil {
+		return nil, err
+	}
+	if err := checkDatabase(opts); err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, newErr(err, "failed to connect to redis")
+	}
+	s := NewMerkleRedisStorage(client, prefix, opts...)
+	if err := s.CheckFormat(ctx); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewMerkleRedisStorageFromURL connects to the Redis server at url, in the
+// format accepted by redis.ParseURL, and returns a Storage for the tree
+// identified by prefix once the server answers a ping. rediss:// URLs connect
+// over TLS 1.2 or later, verifying the server certificate against the host
+// name. The store owns the client it creates, so Close closes it.
+func NewMerkleRedisStorageFromURL(ctx context.Context, url, prefix string, opts ...Option) (*Storage, error) {
+	client, err := clientFromURL(url)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]Option{WithOwnedClient(true)}, opts...)
+	s, err := NewMerkleRedisStorageChecked(ctx, client, prefix, opts...)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// clientFromURL creates the client for NewMerkleRedisStorageFromURL.
+func clientFromURL(url string) (*redis.Client, error) {
+	o, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, newErr(err, "invalid redis URL")
+	}
+	if o.TLSConfig != nil && o.TLSConfig.MinVersion < tls.VersionTLS12 {
+		o.TLSConfig.MinVersion = tls.VersionTLS12
+	}
+	return redis.NewClient(o), nil
+}
+
+var _ merkletree.Storage = (*Storage)(nil)
+
 // Storage implements the db.Storage interface
 type Storage struct {
-	db           *redis.Client
+	db     redis.UniversalClient
+	prefix string
+	// mtID is the tree ID the keys are scoped to, see
+	// NewMerkleRedisStorageWithID; nil for none.
+	mtID         *uint64
 	nodeIdPrefix string
 	rootId       string
-	currentRoot  *merkletree.Hash
+	// readDb serves Get, GetMulti and GetRoot when set.
+	readDb redis.UniversalClient
+	// secondary mirrors writes and serves reads the primary fails, see
+	// WithFailover.
+	secondary redis.UniversalClient
+	// rootMu guards currentRoot, rootLoadedAt and rootGen
+	rootMu      sync.RWMutex
+	currentRoot *merkletree.Hash
+	// rootLoadedAt is when currentRoot was last set.
+	rootLoadedAt time.Time
+	// rootGen is incremented when currentRoot is invalidated.
+	rootGen          uint64
+	rootInvalidation RootInvalidation
+	// noRootCache disables currentRoot, see WithRootCache.
+	noRootCache bool
+	// rootSub receives root change notifications, see KeyspaceNotifications.
+	rootSub *redis.PubSub
+	// hexEncoding stores values hex encoded, as versions before raw value
+	// storage did.
+	hexEncoding bool
+	// ttl is the expiration applied to every key written, 0 for none.
+	ttl time.Duration
+	// slidingTTL refreshes the expiry of nodes on Get, see WithSlidingTTL.
+	slidingTTL bool
+	// ownsClient makes Close close db.
+	ownsClient bool
+	// closeClients are the clients Close closes.
+	closeClients []redis.UniversalClient
+	// database is the database selected by WithDatabase, if selectDatabase.
+	database       int
+	selectDatabase bool
+	// rootHistory is the number of past roots kept, 0 to keep none.
+	rootHistory int
+	metrics     Metrics
+	tracer      Tracer
+	compressor  Compressor
+	// codecTag and codec compress written nodes, see WithCodec; codecTag is
+	// 0 when unset.
+	codecTag byte
+	codec    Compressor
+	// opTimeout bounds every operation, 0 for no bound.
+	opTimeout time.Duration
+	// perKeyDeadline bounds each segment of PutBatch and HasMulti, see
+	// WithPerKeyDeadline; 0 for no bound.
+	perKeyDeadline time.Duration
+	// keyEncoder encodes merkle keys into node key names, nil for hex.
+	keyEncoder func([]byte) string
+	// nodeCache caches decoded nodes, nil to disable.
+	nodeCache *nodeCache
+	// strictSetRoot makes SetRoot reject roots whose node isn't stored.
+	strictSetRoot bool
+	// opts are the options the store was created with, see WithPrefix.
+	opts []Option
+	// nodeCounter maintains the node count in a counter key, see NodeCount.
+	nodeCounter bool
+	// retryAttempts and retryBackoff configure retries, see WithRetry.
+	retryAttempts int
+	retryBackoff  time.Duration
+	// maxNodeBytes caps the serialized size of written nodes, 0 for no cap.
+	maxNodeBytes int
+	// extendedEntries lets PutEntry and GetEntry handle leaf entries of any
+	// length, see WithExtendedEntries.
+	extendedEntries bool
+	// compactNodes writes nodes with MarshalNodeItemCompact, see
+	// WithCompactNodes.
+	compactNodes bool
+	// scriptedAccess reads and writes nodes with scripts, see
+	// WithScriptedAccess.
+	scriptedAccess bool
+	// wal logs writes before they are sent, see WithWAL; nil for none.
+	wal *wal
+	// asyncBuffer is the queue size of asynchronous writes, see
+	// WithAsyncWrites, and async writes them; nil if they are disabled.
+	asyncBuffer int
+	async       *asyncWriter
+	// asyncErrorHandler receives the errors of asynchronous writes, see
+	// WithAsyncErrorHandler.
+	asyncErrorHandler func(error)
+	// scanBatch is the COUNT hint of SCAN, see WithScanBatch; 0 for
+	// defaultScanBatch.
+	scanBatch int
+	// logger receives warnings and errors, see WithLogger; nil to discard
+	// them.
+	logger Logger
+	// rootCodec serializes root values, see WithRootCodec; nil for the
+	// plain hash.
+	rootCodec RootCodec
+	// separator joins the prefix to node keys and derived prefixes, see
+	// WithSeparator; empty for defaultSeparator.
+	separator string
+	// noServerPath is set once the server turned out not to support the
+	// function of ServerSidePathNodes.
+	noServerPath atomic.Bool
+	// formatVersion is the format version recorded and expected, see
+	// WithFormatVersion; 0 for currentFormatVersion. formatRecorded is set
+	// once the store has recorded it.
+	formatVersion  int
+	formatRecorded atomic.Bool
+	// clusterHashTag wraps the prefix of key names in a hash tag, see
+	// WithClusterHashTag.
+	clusterHashTag bool
 }
 
+// Sizes of the node fields, from the merkletree types they convert to.
+const (
+	// hashLen is the length of a node hash, the size of each child.
+	hashLen = len(merkletree.Hash{})
+	// elemLen is the length of each of the two elements of a leaf entry.
+	elemLen = merkletree.ElemBytesLen
+	// entryLen is the length of a leaf entry, its elements concatenated.
+	entryLen = 2 * elemLen
+)
+
+// entry elements are converted to and from merkletree.Hash values, so this
+// fails to compile if their sizes ever differ
+var _ = [1]struct{}{}[elemLen-hashLen]
+
 type NodeItem struct {
 	Type byte   `db:"type"`
 	Key  []byte `db:"key"`
@@ -55,24 +316,96 @@ type NodeItem struct {
 	ChildR []byte `db:"child_r"`
 	// Entry is the data stored in a leaf node.
 	Entry []byte `db:"entry"`
+	// Meta is application metadata stored with the node, see PutWithMeta.
+	Meta []byte `db:"meta"`
 }
 
 type RootItem struct {
+	// MTId identifies the tree within its prefix, see
+	// NewMerkleRedisStorageWithID.
 	MTId uint64 `db:"mt_id"`
 	Key  []byte `db:"key"`
 }
 
-func bytesToNodeItem(d []byte) (*NodeItem, error) {
-	dLen := len(d)
-	if dLen < 17 {
-		return nil, fmt.Errorf("corrupted merkle node: invalid header")
+// nodeFormatFlag is set in the first byte of versioned serialized nodes, with
+// the format version in the low bits. Unversioned (v0) nodes start with their
+// type byte, which never has it set, and compressed values start with
+// compressedTag, which is above every version.
+const nodeFormatFlag byte = 0x80
+
+// nodeFormatVersion is the version MarshalNodeItem writes for nodes without
+// metadata.
+const nodeFormatVersion byte = 1
+
+// nodeFormatVersionMeta is the version MarshalNodeItem writes for nodes with
+// metadata. Nodes without it are still written as version 1, which releases
+// predating metadata can read.
+const nodeFormatVersionMeta byte = 2
+
+// UnmarshalNodeItem decodes a node serialized by MarshalNodeItem or
+// MarshalNodeItemCompact, or in the unversioned format written by earlier
+// releases. It returns an error wrapping ErrCorruptNode if d is not exactly one
+// well-formed node. The fields of the result alias d, and fields that were
+// empty or nil when marshaled are decoded as empty, non-nil slices, except
+// Meta, which is nil for nodes without metadata.
+func UnmarshalNodeItem(d []byte) (*NodeItem, error) {
+	if len(d) == 0 {
+		return nil, newErr(ErrCorruptNode, "invalid header")
+	}
+	if d[0]&nodeFormatFlag == 0 {
+		return unmarshalNodeItemV0(d)
+	}
+	switch d[0] &^ nodeFormatFlag {
+	case nodeFormatVersion:
+		return unmarshalNodeItemV0(d[1:])
+	case nodeFormatVersionMeta:
+		ni, rest, err := unmarshalNodeBody(d[1:])
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) < 4 {
+			return nil, newErr(ErrCorruptNode, "invalid metadata header")
+		}
+		metaLen := int(readUint32LE(rest, 0))
+		if metaLen > len(rest)-4 {
+			return nil, newErr(ErrCorruptNode, "overflow")
+		} else if metaLen < len(rest)-4 {
+			return nil, newErr(ErrCorruptNode, "trailing bytes")
+		}
+		ni.Meta = rest[4:]
+		return ni, nil
+	case nodeFormatVersionCompact:
+		return unmarshalNodeItemCompact(d[1:])
+	default:
+		return nil, newErr(ErrCorruptNode, fmt.Sprintf("unsupported format version %d", d[0]&^nodeFormatFlag))
+	}
+}
+
+// unmarshalNodeItemV0 decodes the unversioned layout, which is also the body
+// of version 1.
+func unmarshalNodeItemV0(d []byte) (*NodeItem, error) {
+	ni, rest, err := unmarshalNodeBody(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, newErr(ErrCorruptNode, "trailing bytes")
+	}
+	return ni, nil
+}
+
+// unmarshalNodeBody decodes the type, field lengths and fields at the start of
+// d, the body of every format version, and returns the bytes that follow.
+func unmarshalNodeBody(d []byte) (*NodeItem, []byte, error) {
+	if len(d) < 17 {
+		return nil, nil, newErr(ErrCorruptNode, "invalid header")
 	}
 	keyLen := int(readUint32LE(d, 1))
 	childLLen := int(readUint32LE(d, 5))
 	childRLen := int(readUint32LE(d, 9))
 	entryLen := int(readUint32LE(d, 13))
 	if (keyLen + childLLen + childRLen + entryLen + 17) > len(d) {
-		return nil, fmt.Errorf("corrupted merkle node: overflow")
+		return nil, nil, newErr(ErrCorruptNode, "overflow")
 	}
 
 	ni := &NodeItem{
@@ -86,12 +419,42 @@ func bytesToNodeItem(d []byte) (*NodeItem, error) {
 	ni.ChildR = d[p:(p + childRLen)]
 	p += childRLen
 	ni.Entry = d[p:(p + entryLen)]
+	p += entryLen
 
-	return ni, nil
-
+	return ni, d[p:], nil
 }
-func nodeItemToBytes(n *NodeItem) []byte {
-	d := make([]byte, 17+len(n.Key)+len(n.ChildL)+len(n.ChildR)+len(n.Entry))
+
+// maxFieldLen is the largest NodeItem field the 32-bit length headers of the
+// serialized format can describe.
+var maxFieldLen uint64 = math.MaxUint32
+
+// MarshalNodeItem serializes a node in the format stored in Redis, before any
+// compression or hex encoding. Version 1 of the format is a version byte of
+// 0x81, then the type byte, then the lengths of Key, ChildL, ChildR and Entry
+// as little endian uint32s, then the four fields in that order. Nodes with Meta
+// are written as version 2, which starts with 0x82 and appends the length of
+// Meta as a little endian uint32 and then Meta to the version 1 layout. It
+// fails if a field is too long for its length header.
+func MarshalNodeItem(n *NodeItem) ([]byte, error) {
+	total := uint64(18)
+	if len(n.Meta) > 0 {
+		total += 4
+	}
+	for _, f := range [][]byte{n.Key, n.ChildL, n.ChildR, n.Entry, n.Meta} {
+		if uint64(len(f)) > maxFieldLen {
+			return nil, fmt.Errorf("merkle node field of %d bytes exceeds the %d byte limit", len(f), maxFieldLen)
+		}
+		total += uint64(len(f))
+	}
+	if total > math.MaxInt {
+		return nil, fmt.Errorf("merkle node of %d bytes is too large", total)
+	}
+	b := make([]byte, total)
+	b[0] = nodeFormatFlag | nodeFormatVersion
+	if len(n.Meta) > 0 {
+		b[0] = nodeFormatFlag | nodeFormatVersionMeta
+	}
+	d := b[1:]
 	d[0] = n.Type
 	pos := 17
 	if n.Key != nil {
@@ -117,31 +480,159 @@ func nodeItemToBytes(n *NodeItem) []byte {
 	}
 	if n.Entry != nil {
 		writeUint32LE(d, 13, uint32(len(n.Entry)))
-		copy(d[pos:], n.ChildR)
+		copy(d[pos:], n.Entry)
+		pos += len(n.Entry)
 	} else {
 		writeUint32LE(d, 13, 0)
 	}
-	return d
+	if len(n.Meta) > 0 {
+		writeUint32LE(d, pos, uint32(len(n.Meta)))
+		copy(d[pos+4:], n.Meta)
+	}
+	return b, nil
 }
+
+const hexDigits = "0123456789abcdef"
+
+// getRedisNodeIdForMerkleKey returns the Redis key of the node stored under
+// key. It is on every node operation's path, so the default hex encoding is
+// written straight into a single buffer.
 func (s *Storage) getRedisNodeIdForMerkleKey(key []byte) string {
-	return s.nodeIdPrefix + hex.EncodeToString(key)
+	if s.keyEncoder != nil {
+		return s.nodeIdPrefix + s.keyEncoder(key)
+	}
+	var b strings.Builder
+	b.Grow(len(s.nodeIdPrefix) + 2*len(key))
+	b.WriteString(s.nodeIdPrefix)
+	for _, v := range key {
+		b.WriteByte(hexDigits[v>>4])
+		b.WriteByte(hexDigits[v&0x0f])
+	}
+	return b.String()
+}
+
+// Close writes the nodes still queued in asynchronous mode, see
+// WithAsyncWrites, stops watching the root for changes, see
+// KeyspaceNotifications, and releases the underlying clients if the store owns
+// them, see WithOwnedClient, along with any client it created, see
+// WithDatabase. Shared clients are left open.
+func (s *Storage) Close() error {
+	if s.rootSub != nil {
+		s.rootSub.Close()
+	}
+	// queued writes are logged, so they must be written before the log closes
+	first := s.async.close()
+	if err := s.wal.close(); err != nil && first == nil {
+		first = err
+	}
+	for _, c := range s.closeClients {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// reader returns the client reads are sent to.
+func (s *Storage) reader() redis.UniversalClient {
+	if s.readDb != nil {
+		return s.readDb
+	}
+	return s.db
+}
+
+// withTimeout bounds ctx by the operation timeout, if one is configured.
+func (s *Storage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.opTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.opTimeout)
+}
+
+// encodeValue converts serialized bytes into the value written to redis.
+func (s *Storage) encodeValue(d []byte) interface{} {
+	if s.hexEncoding {
+		return hex.EncodeToString(d)
+	}
+	return d
+}
+
+// decodeValue returns the serialized bytes held in a value read from redis.
+func (s *Storage) decodeValue(v string) ([]byte, error) {
+	if s.hexEncoding {
+		return hex.DecodeString(v)
+	}
+	return []byte(v), nil
+}
+
+// encodeNodeItem serializes item into the value written to redis.
+func (s *Storage) encodeNodeItem(item *NodeItem) (interface{}, error) {
+	marshal := MarshalNodeItem
+	if s.compactNodes {
+		marshal = MarshalNodeItemCompact
+	}
+	d, err := marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	if s.maxNodeBytes > 0 && len(d) > s.maxNodeBytes {
+		return nil, newErr(ErrNodeTooLarge, fmt.Sprintf("node is %d bytes, limit is %d", len(d), s.maxNodeBytes))
+	}
+	if d, err = s.compress(d); err != nil {
+		return nil, err
+	}
+	return s.encodeValue(d), nil
+}
+
+// decodeNodeItem decodes a node value read from redis.
+func (s *Storage) decodeNodeItem(v string) (*NodeItem, error) {
+	d, err := s.decodeValue(v)
+	if err != nil {
+		return nil, newErr(ErrCorruptNode, "invalid hex")
+	}
+	if d, err = s.decompress(d); err != nil {
+		return nil, err
+	}
+	return UnmarshalNodeItem(d)
 }
 
 // Get retrieves a value from a key in the db.Storage
 func (s *Storage) Get(ctx context.Context,
-	key []byte) (*merkletree.Node, error) {
+	key []byte) (_ *merkletree.Node, err error) {
 
-	res := s.db.Get(ctx, s.getRedisNodeIdForMerkleKey(key))
-	if res.Err() == redis.Nil {
-		return nil, merkletree.ErrNotFound
-	} else if res.Err() != nil {
-		return nil, res.Err()
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+	if s.metrics != nil {
+		defer func(start time.Time) { s.metrics.ObserveGet(time.Since(start), err) }(time.Now())
+	}
+	if s.tracer != nil {
+		var span Span
+		ctx, span = s.startSpan(ctx, "Get", s.getRedisNodeIdForMerkleKey(key), key)
+		defer func() { span.End(err) }()
+	}
+
+	if node, ok := s.nodeCache.get(key); ok {
+		return node, nil
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var v string
+	err = s.retry(ctx, func() (err error) {
+		v, err = s.getValue(ctx, s.getRedisNodeIdForMerkleKey(key))
+		return err
+	})
+	if err != nil && err != redis.Nil && s.secondary != nil {
+		v, err = s.secondary.Get(ctx, s.getRedisNodeIdForMerkleKey(key)).Result()
+	}
+	if err == redis.Nil {
+		return nil, ErrNodeNotFound
+	} else if err != nil {
+		return nil, err
 	} else {
-		d, err := hex.DecodeString(res.Val())
-		if err != nil {
-			return nil, fmt.Errorf("corrupt key hex")
-		}
-		item, err := bytesToNodeItem(d)
+		item, err := s.decodeNodeItem(v)
 		if err != nil {
 			return nil, err
 		}
@@ -149,6 +640,7 @@ func (s *Storage) Get(ctx context.Context,
 		if err != nil {
 			return nil, err
 		}
+		s.nodeCache.add(key, node)
 		return node, nil
 	}
 
@@ -156,8 +648,113 @@ func (s *Storage) Get(ctx context.Context,
 
 func (s *Storage) Put(ctx context.Context, key []byte,
 	node *merkletree.Node) error {
+	return s.PutWithMeta(ctx, key, node, nil)
+}
+
+// GetNodeItem returns the item stored under key as it was decoded, before its
+// conversion to a merkletree.Node, or ErrNodeNotFound if there is none.
+// Unlike Get it keeps the stored key and metadata, and returns items that
+// don't convert to a valid node, which makes it suited to inspecting storage.
+// It always reads from Redis.
+func (s *Storage) GetNodeItem(ctx context.Context, key []byte) (*NodeItem, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	v, err := s.getValue(ctx, s.getRedisNodeIdForMerkleKey(key))
+	if err == redis.Nil {
+		return nil, ErrNodeNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return s.decodeNodeItem(v)
+}
 
-	item := &NodeItem{Key: key}
+// Has reports whether a node is stored under key, without transferring it.
+func (s *Storage) Has(ctx context.Context, key []byte) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	n, err := s.reader().Exists(ctx, s.getRedisNodeIdForMerkleKey(key)).Result()
+	if err != nil {
+		return false, newErr(err, "failed to check node")
+	}
+	return n == 1, nil
+}
+
+// HasMulti reports for each of keys whether a node is stored under it, in the
+// order of keys. The checks are pipelined as one EXISTS per key, which works
+// across Redis Cluster slots. With WithPerKeyDeadline, if only some of the
+// checks complete it returns their results, false for the others, with a
+// *PartialError.
+func (s *Storage) HasMulti(ctx context.Context, keys [][]byte) ([]bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	client := s.reader()
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = s.getRedisNodeIdForMerkleKey(key)
+	}
+	cmds := make([]*redis.IntCmd, len(keys))
+	failed, err := s.runSegments(ctx, client, ids, func(ctx context.Context, idx []int) error {
+		pipe := client.Pipeline()
+		for _, i := range idx {
+			cmds[i] = pipe.Exists(ctx, ids[i])
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return newErr(err, "failed to check nodes")
+		}
+		return nil
+	})
+	if err != nil && failed == nil {
+		return nil, err
+	}
+	found := make([]bool, len(keys))
+	for i, cmd := range cmds {
+		found[i] = cmd.Err() == nil && cmd.Val() == 1
+	}
+	if err != nil {
+		return found, newPartialError(keys, failed, err)
+	}
+	return found, nil
+}
+
+// Delete removes the node stored under key, returning ErrNodeNotFound if there
+// was none.
+func (s *Storage) Delete(ctx context.Context, key []byte) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res := s.db.Del(ctx, s.getRedisNodeIdForMerkleKey(key))
+	s.nodeCache.remove(key)
+	if res.Err() != nil {
+		return res.Err()
+	}
+	if res.Val() == 0 {
+		return ErrNodeNotFound
+	}
+	if s.nodeCounter {
+		return s.db.Decr(ctx, s.rootId+nodeCountSuffix).Err()
+	}
+	return nil
+}
+
+// NewNodeItemFromNode converts node, stored under key, into the NodeItem that
+// Put serializes: its type, its children if set, and its entry as its two
+// elements concatenated. It returns an error wrapping
+// merkletree.ErrNodeBytesBadSize if the entry is incomplete. The item copies
+// the node's hashes but shares key.
+func NewNodeItemFromNode(key []byte, node *merkletree.Node) (*NodeItem, error) {
+	item := &NodeItem{Type: byte(node.Type), Key: key}
 
 	if node.ChildL != nil {
 		item.ChildL = append(item.ChildL, node.ChildL[:]...)
@@ -167,72 +764,237 @@ func (s *Storage) Put(ctx context.Context, key []byte,
 		item.ChildR = append(item.ChildR, node.ChildR[:]...)
 	}
 
-	if node.Entry[0] != nil && node.Entry[1] != nil {
-		item.Entry = append(node.Entry[0][:], node.Entry[1][:]...)
+	if node.Entry[0] != nil || node.Entry[1] != nil {
+		if node.Entry[0] == nil || node.Entry[1] == nil {
+			return nil, newErr(merkletree.ErrNodeBytesBadSize, "incomplete node entry")
+		}
+		item.Entry = make([]byte, 0, entryLen)
+		item.Entry = append(append(item.Entry, node.Entry[0][:]...), node.Entry[1][:]...)
+		if len(item.Entry) != entryLen {
+			return nil, newErr(merkletree.ErrNodeBytesBadSize, fmt.Sprintf("leaf entry is %d bytes, want %d", len(item.Entry), entryLen))
+		}
 	}
-
-	res := s.db.Set(ctx, s.getRedisNodeIdForMerkleKey(key), hex.EncodeToString(nodeItemToBytes(item)), 0)
-	return res.Err()
+	return item, nil
 }
 
-// GetRoot retrieves a merkle tree root hash in the interface db.Tx
-func (s *Storage) GetRoot(ctx context.Context) (*merkletree.Hash, error) {
+// GetRoot retrieves a merkle tree root hash in the interface db.Tx. A missing
+// root is reported as merkletree.ErrNotFound itself rather than
+// ErrRootNotFound, as merkletree.NewMerkleTree compares the error with == to
+// create the root of an empty tree; a not-found error from GetRoot always means
+// the tree has no root.
+func (s *Storage) GetRoot(ctx context.Context) (_ *merkletree.Hash, err error) {
+	if s.metrics != nil {
+		defer func(start time.Time) { s.metrics.ObserveGetRoot(time.Since(start), err) }(time.Now())
+	}
+	if s.tracer != nil {
+		var span Span
+		ctx, span = s.startSpan(ctx, "GetRoot", s.rootId, nil)
+		defer func() { span.End(err) }()
+	}
+
 	var root merkletree.Hash
-	if s.currentRoot != nil {
-		copy(root[:], s.currentRoot[:])
+	s.rootMu.RLock()
+	if cached := s.cachedRoot(); cached != nil {
+		copy(root[:], cached[:])
+		s.rootMu.RUnlock()
 		return &root, nil
 	}
+	gen := s.rootGen
+	s.rootMu.RUnlock()
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	res := s.db.Get(ctx, s.rootId)
+	res := s.reader().Get(ctx, s.rootId)
+	failedOver := false
+	if res.Err() != nil && res.Err() != redis.Nil && s.secondary != nil {
+		res = s.secondary.Get(ctx, s.rootId)
+		failedOver = true
+	}
 	if res.Err() == redis.Nil {
 		return nil, merkletree.ErrNotFound
 	} else if res.Err() != nil {
 		return nil, res.Err()
 	} else {
-		d, err := hex.DecodeString(res.Val())
-		if err != nil {
-			return nil, fmt.Errorf("corrupt root hex")
+		if err := s.decodeRoot(s.rootId, res.Val(), &root); err != nil {
+			return nil, err
+		}
+		// the secondary may lag behind, so its root isn't cached once the
+		// primary is back
+		if failedOver {
+			return &root, nil
 		}
-		if s.currentRoot == nil {
-			s.currentRoot = &merkletree.Hash{}
+		s.rootMu.Lock()
+		defer s.rootMu.Unlock()
+		// a concurrent SetRoot may have filled the cache with a newer root,
+		// or an invalidation may have reported one, while we were reading
+		if s.rootGen == gen && s.cachedRoot() == nil {
+			s.cacheRoot(&root)
 		}
-		copy(s.currentRoot[:], d[:])
-		copy(root[:], s.currentRoot[:])
 		return &root, nil
 	}
 }
 
-func (s *Storage) SetRoot(ctx context.Context, hash *merkletree.Hash) error {
-	if s.currentRoot == nil {
-		s.currentRoot = &merkletree.Hash{}
+// encodeRoot converts hash into the root value written to redis, with the
+// RootCodec set with WithRootCodec if any.
+func (s *Storage) encodeRoot(hash *merkletree.Hash) (interface{}, error) {
+	if s.rootCodec == nil {
+		return s.encodeValue(hash[:]), nil
 	}
-	copy(s.currentRoot[:], hash[:])
-	res := s.db.Set(ctx, s.rootId, hex.EncodeToString(hash[:]), 0)
-	if res.Err() != nil {
-		return newErr(res.Err(), "failed to update current root hash")
+	d, err := s.rootCodec.Encode(hash)
+	if err != nil {
+		return nil, newErr(err, "failed to encode root")
+	}
+	return s.encodeValue(d), nil
+}
+
+// decodeRoot decodes the root value v read from key into root. It returns an
+// error wrapping ErrCorruptRoot, naming the key and the length of the value, if
+// v isn't exactly one encoded hash or the RootCodec rejects it.
+func (s *Storage) decodeRoot(key, v string, root *merkletree.Hash) error {
+	d, err := s.decodeValue(v)
+	if err != nil {
+		return newErr(ErrCorruptRoot, fmt.Sprintf("invalid hex in %s (%d bytes)", key, len(v)))
+	}
+	if s.rootCodec != nil {
+		h, err := s.rootCodec.Decode(d)
+		if err != nil {
+			return newErr(ErrCorruptRoot, fmt.Sprintf("%s holds %d bytes the root codec rejects: %v", key, len(d), err))
+		}
+		*root = *h
+		return nil
+	}
+	if len(d) != hashLen {
+		return newErr(ErrCorruptRoot, fmt.Sprintf("%s holds %d bytes, want %d", key, len(d), hashLen))
+	}
+	copy(root[:], d)
+	return nil
+}
+
+func (s *Storage) SetRoot(ctx context.Context, hash *merkletree.Hash) (err error) {
+	if s.metrics != nil {
+		defer func(start time.Time) { s.metrics.ObserveSetRoot(time.Since(start), err) }(time.Now())
+	}
+	if s.tracer != nil {
+		var span Span
+		ctx, span = s.startSpan(ctx, "SetRoot", s.rootId, nil)
+		defer func() { span.End(err) }()
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if err := s.checkRootNode(ctx, hash); err != nil {
+		return err
+	}
+
+	v, err := s.encodeRoot(hash)
+	if err != nil {
+		return err
+	}
+	if err := s.recordFormat(ctx); err != nil {
+		return err
 	}
+	seq, err := s.logWrites(nil, hash)
+	if err != nil {
+		return err
+	}
+	if err := s.writeRoot(ctx, hash, v); err != nil {
+		return s.abortWrites(seq, err)
+	}
+	return s.wal.ack(seq)
+}
+
+// writeRoot sets the root to hash, encoded as v, with its timestamp, tree
+// version and root history, and mirrors it to the secondary. It is the part of
+// SetRoot that Recover replays.
+func (s *Storage) writeRoot(ctx context.Context, hash *merkletree.Hash, v interface{}) error {
+	// hold the lock across the write so the cache and redis observe
+	// concurrent updates in the same order
+	s.rootMu.Lock()
+	defer s.rootMu.Unlock()
+	s.cacheRoot(hash)
+	written := time.Now()
+	err := s.retry(ctx, func() error {
+		pipe := s.db.Pipeline()
+		pipe.Set(ctx, s.rootId, v, s.ttl)
+		pipe.Set(ctx, s.rootId+rootTimestampSuffix, written.UnixNano(), s.ttl)
+		pipe.Incr(ctx, s.rootId+versionSuffix)
+		if s.rootHistory > 0 {
+			s.pushRootHistory(ctx, pipe, v)
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return newErr(err, "failed to update current root hash")
+	}
+	s.mirror(ctx, "root", func(pipe redis.Pipeliner) {
+		pipe.Set(ctx, s.rootId, v, s.ttl)
+		pipe.Set(ctx, s.rootId+rootTimestampSuffix, written.UnixNano(), s.ttl)
+	})
 	return nil
 }
 
+// checkRootNode returns an error wrapping ErrNodeNotFound if WithStrictSetRoot
+// is set and the node of hash isn't stored.
+func (s *Storage) checkRootNode(ctx context.Context, hash *merkletree.Hash) error {
+	if !s.strictSetRoot || *hash == merkletree.HashZero {
+		return nil
+	}
+	n, err := s.db.Exists(ctx, s.getRedisNodeIdForMerkleKey(hash[:])).Result()
+	if err != nil {
+		return newErr(err, "failed to check root node")
+	}
+	if n == 0 {
+		return newErr(ErrNodeNotFound, "root node not found")
+	}
+	return nil
+}
+
+// Node converts the item into a merkletree.Node. The item's Type decides which
+// fields it must hold: both children for a middle node, an entry for a leaf
+// and neither for an empty node. Children must be hashes and the entry two
+// elements long, or the error wraps merkletree.ErrNodeBytesBadSize. An item
+// holding other fields than its type declares, or of an unknown type, is
+// rejected with an error wrapping ErrCorruptNode, so a corrupted type byte
+// can't turn one kind of node into another.
 func (item *NodeItem) Node() (*merkletree.Node, error) {
 	node := merkletree.Node{
 		Type: merkletree.NodeType(item.Type),
 	}
-	if item.ChildL != nil {
+	hasChildren := len(item.ChildL) > 0 || len(item.ChildR) > 0
+	switch node.Type {
+	case merkletree.NodeTypeMiddle:
+		if len(item.Entry) > 0 {
+			return nil, newErr(ErrCorruptNode, "middle node with an entry")
+		}
+		if len(item.ChildL) == 0 || len(item.ChildR) == 0 {
+			return nil, newErr(ErrCorruptNode, "middle node without both children")
+		}
+		if len(item.ChildL) != hashLen || len(item.ChildR) != hashLen {
+			return nil, newErr(merkletree.ErrNodeBytesBadSize, fmt.Sprintf("children are %d and %d bytes, want %d", len(item.ChildL), len(item.ChildR), hashLen))
+		}
 		node.ChildL = &merkletree.Hash{}
-		copy(node.ChildL[:], item.ChildL[:])
-	}
-	if item.ChildR != nil {
+		copy(node.ChildL[:], item.ChildL)
 		node.ChildR = &merkletree.Hash{}
-		copy(node.ChildR[:], item.ChildR[:])
-	}
-	if len(item.Entry) > 0 {
-		if len(item.Entry) != 2*merkletree.ElemBytesLen {
-			return nil, merkletree.ErrNodeBytesBadSize
+		copy(node.ChildR[:], item.ChildR)
+	case merkletree.NodeTypeLeaf:
+		if hasChildren {
+			return nil, newErr(ErrCorruptNode, "leaf node with children")
+		}
+		if len(item.Entry) != entryLen {
+			return nil, newErr(merkletree.ErrNodeBytesBadSize, fmt.Sprintf("leaf entry is %d bytes, want %d", len(item.Entry), entryLen))
 		}
 		node.Entry = [2]*merkletree.Hash{{}, {}}
-		copy(node.Entry[0][:], item.Entry[0:32])
-		copy(node.Entry[1][:], item.Entry[32:64])
+		copy(node.Entry[0][:], item.Entry[:elemLen])
+		copy(node.Entry[1][:], item.Entry[elemLen:])
+	case merkletree.NodeTypeEmpty:
+		if hasChildren || len(item.Entry) > 0 {
+			return nil, newErr(ErrCorruptNode, "empty node with children or an entry")
+		}
+	default:
+		return nil, newErr(ErrCorruptNode, fmt.Sprintf("unknown node type %d", item.Type))
 	}
 	return &node, nil
 }
@@ -244,6 +1006,27 @@ type KV struct {
 	V    merkletree.Node
 }
 
+var (
+	// ErrCorruptNode is returned when a stored node value can't be decoded.
+	ErrCorruptNode = errors.New("corrupted merkle node")
+	// ErrCorruptRoot is returned when a stored root value can't be decoded.
+	ErrCorruptRoot = errors.New("corrupted merkle root")
+	// ErrNodeTooLarge is returned when writing a node larger than the limit
+	// set with WithMaxNodeBytes.
+	ErrNodeTooLarge = errors.New("merkle node too large")
+	// ErrNodeNotFound is returned for a missing node. It wraps
+	// merkletree.ErrNotFound, which the merkletree.Storage interface requires,
+	// so errors.Is matches either.
+	ErrNodeNotFound = newErr(merkletree.ErrNotFound, "merkle node")
+	// ErrRootNotFound is returned for a missing root by GetRootWithTimestamp and
+	// Promote, and wraps merkletree.ErrNotFound like ErrNodeNotFound. GetRoot
+	// returns merkletree.ErrNotFound itself, see its doc.
+	ErrRootNotFound = newErr(merkletree.ErrNotFound, "merkle root")
+	// ErrEmptyKey is returned by Get, Put and Delete for a nil or empty key,
+	// whose Redis key would be the bare node prefix.
+	ErrEmptyKey = errors.New("empty merkle node key")
+)
+
 type storageError struct {
 	err error
 	msg string
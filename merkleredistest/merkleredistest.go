@@ -0,0 +1,25 @@
+// Package merkleredistest provides a Storage backed by an in-process fake
+// Redis server, so code built on the store can be tested without running
+// redis-server.
+package merkleredistest
+
+import (
+	"testing"
+
+	merkleredis "github.com/OpenAssetStandards/go-merkletree-redis-store"
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+)
+
+// NewTestStorage returns a Storage backed by a fresh in-memory server and a
+// func that closes both. The cleanup also runs when the test finishes, so
+// calling it is only needed to tear the server down early.
+func NewTestStorage(t testing.TB, opts ...merkleredis.Option) (*merkleredis.Storage, func()) {
+	t.Helper()
+	srv := fakeredis.New(t)
+	opts = append([]merkleredis.Option{merkleredis.WithOwnedClient(true)}, opts...)
+	s := merkleredis.NewMerkleRedisStorage(srv.Client(t), "test", opts...)
+	return s, func() {
+		s.Close()
+		srv.Close()
+	}
+}
@@ -0,0 +1,48 @@
+package merkleredistest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestNewTestStorage(t *testing.T) {
+	ctx := context.Background()
+	s, cleanup := NewTestStorage(t)
+	defer cleanup()
+
+	if _, err := s.GetRoot(ctx); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("GetRoot on empty store: got %v, want ErrNotFound", err)
+	}
+
+	var k, v merkletree.Hash
+	k[0], v[0] = 1, 2
+	leaf := merkletree.NewNodeLeaf(&k, &v)
+	key, err := leaf.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, key[:], leaf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(ctx, key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != merkletree.NodeTypeLeaf || *got.Entry[0] != k || *got.Entry[1] != v {
+		t.Fatalf("Get returned %+v", got)
+	}
+
+	if err := s.SetRoot(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	root, err := s.GetRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *root != *key {
+		t.Fatalf("GetRoot = %x, want %x", root, key)
+	}
+}
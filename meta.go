@@ -0,0 +1,82 @@
+package merkleredis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// PutWithMeta is like Put, but stores meta, small application metadata such as
+// an insertion time or a source tag, alongside the node. It can be read back
+// with GetMeta and is invisible to the merkle tree. Put, PutBatch and
+// CommitRoot store nodes without metadata, so rewriting the node with them
+// drops it. Nodes with metadata are written in a format that releases
+// predating metadata can't read.
+func (s *Storage) PutWithMeta(ctx context.Context, key []byte, node *merkletree.Node, meta []byte) (err error) {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	if s.metrics != nil {
+		defer func(start time.Time) { s.metrics.ObservePut(time.Since(start), err) }(time.Now())
+	}
+	if s.tracer != nil {
+		var span Span
+		ctx, span = s.startSpan(ctx, "Put", s.getRedisNodeIdForMerkleKey(key), key)
+		defer func() { span.End(err) }()
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	item, err := NewNodeItemFromNode(key, node)
+	if err != nil {
+		return err
+	}
+	item.Meta = meta
+
+	v, err := s.encodeNodeItem(item)
+	if err != nil {
+		return err
+	}
+	seq, err := s.logWrites([]*NodeItem{item}, nil)
+	if err != nil {
+		return err
+	}
+	if s.async != nil {
+		err := s.async.queue(ctx, asyncWrite{
+			key: key, node: node, id: s.getRedisNodeIdForMerkleKey(key), value: v, seq: seq,
+		})
+		if err != nil {
+			return s.abortWrites(seq, err)
+		}
+		return nil
+	}
+	err = s.retry(ctx, func() error {
+		return s.putValue(ctx, s.getRedisNodeIdForMerkleKey(key), v)
+	})
+	if err != nil {
+		return s.abortWrites(seq, err)
+	}
+	s.mirror(ctx, "node", func(pipe redis.Pipeliner) {
+		pipe.Set(ctx, s.getRedisNodeIdForMerkleKey(key), v, s.ttl)
+	})
+	if err := s.wal.ack(seq); err != nil {
+		return err
+	}
+	s.nodeCache.add(key, node)
+	return nil
+}
+
+// GetMeta returns the metadata stored with the node under key by PutWithMeta,
+// which is empty if the node was stored without any, or
+// ErrNodeNotFound if there is no node. It always reads from Redis, as
+// the node cache doesn't hold metadata.
+func (s *Storage) GetMeta(ctx context.Context, key []byte) ([]byte, error) {
+	item, err := s.GetNodeItem(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return item.Meta, nil
+}
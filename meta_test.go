@@ -0,0 +1,105 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestNodeMeta(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"raw", nil},
+		{"hex", []Option{WithHexEncoding()}},
+		{"compressed", []Option{WithCodec(CodecGzip, nil), WithNodeCache(8)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := fakeredis.New(t)
+			s := NewMerkleRedisStorage(srv.Client(t), "meta", tc.opts...)
+			leaf := merkletree.NewNodeLeaf(testHash(1), testHash(2))
+			meta := []byte("source=import;ts=1700000000")
+
+			if err := s.PutWithMeta(ctx, []byte("with"), leaf, meta); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Put(ctx, []byte("without"), leaf); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.GetMeta(ctx, []byte("with"))
+			if err != nil || !bytes.Equal(got, meta) {
+				t.Fatalf("with metadata: got %q, %v, want %q", got, err, meta)
+			}
+			if got, err := s.GetMeta(ctx, []byte("without")); err != nil || len(got) != 0 {
+				t.Fatalf("without metadata: got %q, %v", got, err)
+			}
+			if _, err := s.GetMeta(ctx, []byte("missing")); !errors.Is(err, merkletree.ErrNotFound) {
+				t.Fatalf("missing node: got %v, want ErrNotFound", err)
+			}
+
+			// the metadata doesn't change the node the tree sees
+			fresh := NewMerkleRedisStorageUniversal(s.db, "meta", tc.opts...)
+			for _, k := range []string{"with", "without"} {
+				node, err := fresh.Get(ctx, []byte(k))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if node.Type != leaf.Type || *node.Entry[0] != *leaf.Entry[0] || *node.Entry[1] != *leaf.Entry[1] {
+					t.Fatalf("%s: got %+v, want %+v", k, node, leaf)
+				}
+			}
+			if problems, err := fresh.VerifyIntegrity(ctx); err != nil || len(problems) != 0 {
+				t.Fatalf("integrity: got %v, %v", problems, err)
+			}
+		})
+	}
+}
+
+func TestMarshalNodeItemMeta(t *testing.T) {
+	item := &NodeItem{Type: 1, Key: []byte{9}, Entry: []byte{4, 4}, Meta: []byte{7, 7, 7}}
+	d, err := MarshalNodeItem(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x82, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 9, 4, 4, 3, 0, 0, 0, 7, 7, 7}
+	if !bytes.Equal(d, want) {
+		t.Fatalf("got %x, want %x", d, want)
+	}
+	got, err := UnmarshalNodeItem(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Key, item.Key) || !bytes.Equal(got.Entry, item.Entry) || !bytes.Equal(got.Meta, item.Meta) {
+		t.Fatalf("got %+v, want %+v", got, item)
+	}
+
+	// without metadata the node keeps the version 1 layout
+	item.Meta = nil
+	v1, err := MarshalNodeItem(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1[0] != 0x81 || len(v1) != len(d)-7 {
+		t.Fatalf("without metadata: got %x", v1)
+	}
+	if got, err := UnmarshalNodeItem(v1); err != nil || got.Meta != nil {
+		t.Fatalf("without metadata: got %+v, %v", got, err)
+	}
+
+	for _, bad := range [][]byte{
+		d[:len(d)-1],                         // metadata cut short
+		append(d[:21:21], 0),                 // truncated metadata length
+		append(append([]byte(nil), d...), 0), // trailing byte
+	} {
+		if _, err := UnmarshalNodeItem(bad); !errors.Is(err, ErrCorruptNode) {
+			t.Fatalf("%x: got %v, want ErrCorruptNode", bad, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package merkleredis
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// Metrics receives the duration and outcome of every storage operation. Get
+// reports ErrNodeNotFound for missing nodes like any other error, so
+// implementations that track failures should filter it out with errors.Is.
+//
+// No Prometheus implementation ships with the package. One takes a histogram
+// vector labeled by operation and outcome, and observes d.Seconds() in each
+// method.
+type Metrics interface {
+	ObserveGet(d time.Duration, err error)
+	ObservePut(d time.Duration, err error)
+	ObserveGetRoot(d time.Duration, err error)
+	ObserveSetRoot(d time.Duration, err error)
+}
+
+// WithMetrics reports every Get, Put, GetRoot and SetRoot to m.
+func WithMetrics(m Metrics) Option {
+	return func(s *Storage) {
+		s.metrics = m
+	}
+}
+
+// PoolStats returns the connection pool statistics of the client the store
+// writes to, for tuning its pool size. For a ClusterClient they are summed over
+// the pools of every node. It returns nil if the store has no client or the
+// client reports no statistics.
+func (s *Storage) PoolStats() *redis.PoolStats {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.PoolStats()
+}
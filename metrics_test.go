@@ -0,0 +1,103 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+type fakeMetrics struct {
+	mu     sync.Mutex
+	calls  map[string]int
+	errors map[string]int
+}
+
+func newFakeMetrics() *fakeMetrics {
+	return &fakeMetrics{calls: map[string]int{}, errors: map[string]int{}}
+}
+
+func (m *fakeMetrics) observe(op string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls[op]++
+	if err != nil {
+		m.errors[op]++
+	}
+}
+
+func (m *fakeMetrics) ObserveGet(d time.Duration, err error)     { m.observe("get", err) }
+func (m *fakeMetrics) ObservePut(d time.Duration, err error)     { m.observe("put", err) }
+func (m *fakeMetrics) ObserveGetRoot(d time.Duration, err error) { m.observe("getroot", err) }
+func (m *fakeMetrics) ObserveSetRoot(d time.Duration, err error) { m.observe("setroot", err) }
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	m := newFakeMetrics()
+	s := NewMerkleRedisStorage(srv.Client(t), "metrics", WithMetrics(m))
+
+	if _, err := s.GetRoot(ctx); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatal(err)
+	}
+	for i := byte(0); i < 3; i++ {
+		if err := s.Put(ctx, []byte{i}, merkletree.NewNodeLeaf(testHash(i), testHash(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := byte(0); i < 4; i++ {
+		s.Get(ctx, []byte{i})
+	}
+	if err := s.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetRoot(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	wantCalls := map[string]int{"get": 4, "put": 3, "getroot": 2, "setroot": 1}
+	wantErrors := map[string]int{"get": 1, "getroot": 1}
+	for op, n := range wantCalls {
+		if m.calls[op] != n {
+			t.Errorf("%s: got %d calls, want %d", op, m.calls[op], n)
+		}
+		if m.errors[op] != wantErrors[op] {
+			t.Errorf("%s: got %d errors, want %d", op, m.errors[op], wantErrors[op])
+		}
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "pool")
+
+	before := *s.PoolStats()
+	newTestTree(t, s, 8)
+	for i := 0; i < 8; i++ {
+		if _, err := s.GetRoot(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after := s.PoolStats()
+	if after.Hits+after.Misses <= before.Hits+before.Misses {
+		t.Fatalf("no pool activity: before %+v, after %+v", before, *after)
+	}
+	if after.TotalConns == 0 {
+		t.Fatalf("no connections: %+v", *after)
+	}
+
+	cluster := NewMerkleRedisStorageUniversal(srv.ClusterClient(t), "poolcluster")
+	newTestTree(t, cluster, 4)
+	if stats := cluster.PoolStats(); stats == nil || stats.TotalConns == 0 {
+		t.Fatalf("cluster pool stats: %+v", stats)
+	}
+
+	if stats := NewMerkleRedisStorageUniversal(nil, "pool").PoolStats(); stats != nil {
+		t.Fatalf("got %+v without a client", *stats)
+	}
+}
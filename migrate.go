@@ -0,0 +1,70 @@
+package merkleredis
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// migrateBatchSize is the number of nodes MigrateFromSQL writes per PutBatch.
+const migrateBatchSize = 1000
+
+const selectNodesStmt = `SELECT key, type, child_l, child_r, entry FROM mt_nodes WHERE mt_id = $1`
+
+const selectRootStmt = `SELECT key FROM mt_roots WHERE mt_id = $1`
+
+// MigrateFromSQL copies the tree mtID of a SQL-backed store, with the mt_nodes
+// and mt_roots tables of go-merkletree-sql, into this store: its nodes first,
+// with PutBatch, and its root last, with SetRoot, so the root never refers to
+// a missing node. A tree without a root in mt_roots is copied without one. The
+// placeholders of the queries are written $1, as PostgreSQL and SQLite accept.
+// Nodes are converted as NodeItem fields, from the columns named by their db
+// tags, and invalid ones fail the migration.
+func (s *Storage) MigrateFromSQL(ctx context.Context, db *sql.DB, mtID uint64) error {
+	rows, err := db.QueryContext(ctx, selectNodesStmt, mtID)
+	if err != nil {
+		return newErr(err, "failed to query nodes")
+	}
+	defer rows.Close()
+
+	batch := make([]KV, 0, migrateBatchSize)
+	for rows.Next() {
+		var item NodeItem
+		if err := rows.Scan(&item.Key, &item.Type, &item.ChildL, &item.ChildR, &item.Entry); err != nil {
+			return newErr(err, "failed to read node")
+		}
+		node, err := item.Node()
+		if err != nil {
+			return newErr(err, fmt.Sprintf("invalid node %x", item.Key))
+		}
+		batch = append(batch, KV{MTId: mtID, K: item.Key, V: *node})
+		if len(batch) == migrateBatchSize {
+			if err := s.PutBatch(ctx, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return newErr(err, "failed to read nodes")
+	}
+	if err := s.PutBatch(ctx, batch); err != nil {
+		return err
+	}
+
+	root := RootItem{MTId: mtID}
+	err = db.QueryRowContext(ctx, selectRootStmt, mtID).Scan(&root.Key)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return newErr(err, "failed to read root")
+	}
+	var hash merkletree.Hash
+	if len(root.Key) != len(hash) {
+		return newErr(ErrCorruptRoot, fmt.Sprintf("mt_roots holds %d bytes for tree %d, want %d", len(root.Key), mtID, len(hash)))
+	}
+	copy(hash[:], root.Key)
+	return s.SetRoot(ctx, &hash)
+}
@@ -0,0 +1,207 @@
+package merkleredis
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// The fake SQL driver serves the two queries of MigrateFromSQL from fixtures
+// registered by name, as no SQL engine is available to the tests.
+
+type sqlNodeRow struct {
+	mtID   uint64
+	item   NodeItem
+	typeOf interface{}
+}
+
+type sqlFixture struct {
+	nodes []sqlNodeRow
+	roots map[uint64][]byte
+}
+
+var (
+	sqlFixturesMu sync.Mutex
+	sqlFixtures   = map[string]*sqlFixture{}
+)
+
+func init() {
+	sql.Register("merkleredis-fake", fakeSQLDriver{})
+}
+
+func openSQLFixture(t *testing.T, f *sqlFixture) *sql.DB {
+	sqlFixturesMu.Lock()
+	sqlFixtures[t.Name()] = f
+	sqlFixturesMu.Unlock()
+	db, err := sql.Open("merkleredis-fake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type fakeSQLDriver struct{}
+
+func (fakeSQLDriver) Open(name string) (driver.Conn, error) {
+	sqlFixturesMu.Lock()
+	defer sqlFixturesMu.Unlock()
+	f, ok := sqlFixtures[name]
+	if !ok {
+		return nil, errors.New("no fixture " + name)
+	}
+	return fakeSQLConn{f}, nil
+}
+
+type fakeSQLConn struct {
+	f *sqlFixture
+}
+
+func (c fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeSQLStmt{c.f, query}, nil
+}
+
+func (fakeSQLConn) Close() error { return nil }
+
+func (fakeSQLConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+type fakeSQLStmt struct {
+	f     *sqlFixture
+	query string
+}
+
+func (fakeSQLStmt) Close() error  { return nil }
+func (fakeSQLStmt) NumInput() int { return 1 }
+
+func (fakeSQLStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("read-only fixture")
+}
+
+func (st fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	mtID := uint64(args[0].(int64))
+	switch st.query {
+	case selectNodesStmt:
+		rows := &fakeSQLRows{columns: []string{"key", "type", "child_l", "child_r", "entry"}}
+		for _, n := range st.f.nodes {
+			if n.mtID != mtID {
+				continue
+			}
+			typ := n.typeOf
+			if typ == nil {
+				typ = int64(n.item.Type)
+			}
+			rows.values = append(rows.values, []driver.Value{
+				n.item.Key, typ, nullBytes(n.item.ChildL), nullBytes(n.item.ChildR), nullBytes(n.item.Entry),
+			})
+		}
+		return rows, nil
+	case selectRootStmt:
+		rows := &fakeSQLRows{columns: []string{"key"}}
+		if key, ok := st.f.roots[mtID]; ok {
+			rows.values = append(rows.values, []driver.Value{key})
+		}
+		return rows, nil
+	}
+	return nil, errors.New("unexpected query " + st.query)
+}
+
+// nullBytes returns empty columns as NULL, as the SQL store writes them.
+func nullBytes(b []byte) driver.Value {
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
+
+type fakeSQLRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeSQLRows) Columns() []string { return r.columns }
+func (r *fakeSQLRows) Close() error      { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestMigrateFromSQL(t *testing.T) {
+	ctx := context.Background()
+	source, _ := newTestStorage(t, "sqlsource")
+	tree := newTestTree(t, source, 20)
+	kvs, err := source.List(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := append(append([]byte(nil), testHash(1)[:]...), testHash(2)[:]...)
+	f := &sqlFixture{roots: map[uint64][]byte{1: tree.Root()[:], 2: testHash(7)[:]}}
+	for _, kv := range kvs {
+		item, err := NewNodeItemFromNode(kv.K, &kv.V)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.nodes = append(f.nodes, sqlNodeRow{mtID: 1, item: *item})
+	}
+	// other trees of the same tables
+	f.nodes = append(f.nodes,
+		sqlNodeRow{mtID: 2, item: NodeItem{Type: byte(merkletree.NodeTypeEmpty), Key: []byte("other")}},
+		sqlNodeRow{mtID: 3, item: NodeItem{Type: byte(merkletree.NodeTypeEmpty), Key: []byte("rootless")}},
+		sqlNodeRow{mtID: 4, item: NodeItem{Type: byte(merkletree.NodeTypeLeaf), Key: []byte("bad"), ChildL: testHash(1)[:]}},
+		sqlNodeRow{mtID: 5, item: NodeItem{Key: []byte("text type"), Entry: entry}, typeOf: []byte("1")},
+	)
+	db := openSQLFixture(t, f)
+
+	s, _ := newTestStorage(t, "sqltarget")
+	if err := s.MigrateFromSQL(ctx, db, 1); err != nil {
+		t.Fatal(err)
+	}
+	checkRoot(t, s, tree.Root())
+	if problems, err := s.VerifyIntegrity(ctx); err != nil || len(problems) != 0 {
+		t.Fatalf("VerifyIntegrity: got %v, %v", problems, err)
+	}
+	if n, err := s.NodeCount(ctx); err != nil || n != int64(len(kvs)) {
+		t.Fatalf("NodeCount: got %d, %v, want %d", n, err, len(kvs))
+	}
+	if ok, err := s.Has(ctx, []byte("other")); err != nil || ok {
+		t.Fatalf("node of another tree migrated: %v, %v", ok, err)
+	}
+
+	rootless, _ := newTestStorage(t, "sqlrootless")
+	if err := rootless.MigrateFromSQL(ctx, db, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rootless.Get(ctx, []byte("rootless")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rootless.GetRoot(ctx); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("GetRoot: got %v, want ErrNotFound", err)
+	}
+
+	bad, _ := newTestStorage(t, "sqlbad")
+	if err := bad.MigrateFromSQL(ctx, db, 4); !errors.Is(err, ErrCorruptNode) {
+		t.Fatalf("invalid node: got %v, want ErrCorruptNode", err)
+	}
+
+	// drivers may return the type column as text
+	text, _ := newTestStorage(t, "sqltext")
+	if err := text.MigrateFromSQL(ctx, db, 5); err != nil {
+		t.Fatal(err)
+	}
+	if node, err := text.Get(ctx, []byte("text type")); err != nil || node.Type != merkletree.NodeTypeLeaf {
+		t.Fatalf("got %v, %v, want a leaf", node, err)
+	}
+}
@@ -0,0 +1,109 @@
+package merkleredis
+
+import (
+	"container/list"
+	"encoding/hex"
+	"sync"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// nodeCache is a least recently used cache of decoded nodes, keyed by the hex
+// encoded merkle key. It is safe for concurrent use, and a nil *nodeCache
+// caches nothing.
+type nodeCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type nodeCacheEntry struct {
+	key  string
+	node *merkletree.Node
+}
+
+func newNodeCache(size int) *nodeCache {
+	return &nodeCache{size: size, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// get returns a copy of the node cached under key.
+func (c *nodeCache) get(key []byte) (*merkletree.Node, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[hex.EncodeToString(key)]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return copyNode(e.Value.(*nodeCacheEntry).node), true
+}
+
+// add caches a copy of node under key, evicting the least recently used node
+// if the cache is full.
+func (c *nodeCache) add(key []byte, node *merkletree.Node) {
+	if c == nil {
+		return
+	}
+	k := hex.EncodeToString(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[k]; ok {
+		e.Value.(*nodeCacheEntry).node = copyNode(node)
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[k] = c.ll.PushFront(&nodeCacheEntry{key: k, node: copyNode(node)})
+	if c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*nodeCacheEntry).key)
+	}
+}
+
+func (c *nodeCache) remove(key []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := hex.EncodeToString(key)
+	if e, ok := c.items[k]; ok {
+		c.ll.Remove(e)
+		delete(c.items, k)
+	}
+}
+
+func (c *nodeCache) purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = map[string]*list.Element{}
+}
+
+// copyNode returns a deep copy of n, so that cached nodes can't be modified
+// through the pointers handed to callers.
+func copyNode(n *merkletree.Node) *merkletree.Node {
+	c := &merkletree.Node{Type: n.Type}
+	if n.ChildL != nil {
+		h := *n.ChildL
+		c.ChildL = &h
+	}
+	if n.ChildR != nil {
+		h := *n.ChildR
+		c.ChildR = &h
+	}
+	for i, e := range n.Entry {
+		if e != nil {
+			h := *e
+			c.Entry[i] = &h
+		}
+	}
+	return c
+}
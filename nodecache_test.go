@@ -0,0 +1,102 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestNodeCache(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	writer := NewMerkleRedisStorage(srv.Client(t), "cache")
+	s := NewMerkleRedisStorage(srv.Client(t), "cache", WithNodeCache(2))
+
+	kvs := testLeafKVs(3)
+	if err := writer.PutBatch(ctx, kvs); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		got, err := s.Get(ctx, kvs[0].K)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got.Entry[1] != *kvs[0].V.Entry[1] {
+			t.Fatalf("got %+v, want %+v", got, kvs[0].V)
+		}
+		// callers can't modify the cached node
+		got.Entry[1][0] ^= 0xff
+	}
+	if n := srv.Count("GET"); n != 1 {
+		t.Fatalf("got %d GET commands, want 1", n)
+	}
+
+	// kvs[0] is evicted as the least recently used node
+	for _, kv := range kvs[1:] {
+		if _, err := s.Get(ctx, kv.K); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Get(ctx, kvs[0].K); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Count("GET"); n != 4 {
+		t.Fatalf("got %d GET commands, want 4", n)
+	}
+
+	if err := s.Delete(ctx, kvs[0].K); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, kvs[0].K); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+
+	// Put populates the cache
+	if err := s.Put(ctx, kvs[0].K, &kvs[0].V); err != nil {
+		t.Fatal(err)
+	}
+	gets := srv.Count("GET")
+	if _, err := s.Get(ctx, kvs[0].K); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Count("GET"); n != gets {
+		t.Fatal("Get after Put went to redis")
+	}
+}
+
+func TestNodeCacheConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "cacherace", WithNodeCache(8))
+
+	kvs := testLeafKVs(16)
+	if err := s.PutBatch(ctx, kvs); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				kv := kvs[(i+j)%len(kvs)]
+				if j%10 == 0 {
+					if err := s.Put(ctx, kv.K, &kv.V); err != nil {
+						t.Error(err)
+						return
+					}
+					continue
+				}
+				if _, err := s.Get(ctx, kv.K); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
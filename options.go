@@ -0,0 +1,253 @@
+package merkleredis
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// Option configures optional Storage behaviour.
+type Option func(*Storage)
+
+// WithHexEncoding stores node and root values as hex strings instead of raw
+// bytes. Use it to keep reading and writing data created by versions of this
+// package that predate raw value storage.
+func WithHexEncoding() Option {
+	return func(s *Storage) {
+		s.hexEncoding = true
+	}
+}
+
+// WithTTL makes every node and root key written by the store expire after d,
+// so short-lived trees are removed by Redis automatically. A zero d disables
+// expiry, which is the default.
+func WithTTL(d time.Duration) Option {
+	return func(s *Storage) {
+		s.ttl = d
+	}
+}
+
+// WithSlidingTTL makes Get and GetNodeItem restart the expiry of the nodes
+// they read when a TTL is set with WithTTL, so nodes in use don't expire while
+// idle ones still do. The read and the refresh are a single GETEX command,
+// which requires Redis 6.2, sent to the primary even with WithReadClient.
+// Nodes served from the node cache, read by GetMulti or scans, or read through
+// WithScriptedAccess aren't refreshed.
+func WithSlidingTTL(enabled bool) Option {
+	return func(s *Storage) {
+		s.slidingTTL = enabled
+	}
+}
+
+// WithOwnedClient marks the client as owned by the store, so that Close also
+// closes it, along with the clients set with WithReadClient and WithFailover.
+// Leave it unset when the client is shared with other code.
+func WithOwnedClient(owned bool) Option {
+	return func(s *Storage) {
+		s.ownsClient = owned
+	}
+}
+
+// WithRootHistory keeps the last n roots set on the store in a Redis list, see
+// GetRootHistory. The default of 0 keeps no history.
+func WithRootHistory(n int) Option {
+	return func(s *Storage) {
+		s.rootHistory = n
+	}
+}
+
+// WithOperationTimeout bounds every store operation by d, on top of any
+// deadline of the caller's context. Scans apply it to each page rather than to
+// the whole iteration. go-redis only interrupts a command in flight when the
+// client is created with ContextTimeoutEnabled; otherwise its own read and
+// write timeouts still apply.
+func WithOperationTimeout(d time.Duration) Option {
+	return func(s *Storage) {
+		s.opTimeout = d
+	}
+}
+
+// WithKeyEncoder sets how merkle keys are encoded into Redis key names, for
+// example base64.RawURLEncoding.EncodeToString for shorter keys. The default is
+// hex. enc must be injective, and every store sharing a tree must use the same
+// encoder, or they won't find each other's nodes.
+func WithKeyEncoder(enc func([]byte) string) Option {
+	return func(s *Storage) {
+		s.keyEncoder = enc
+	}
+}
+
+// WithReadClient sends Get, GetMulti and GetRoot to client, typically a
+// replica, while writes stay on the primary client. Replication is
+// asynchronous, so a read can miss a write that has just been acknowledged.
+// GetRoot only reads the root once per store and caches it.
+func WithReadClient(client redis.UniversalClient) Option {
+	return func(s *Storage) {
+		s.readDb = client
+	}
+}
+
+// WithRootInvalidation makes the store notice root changes made by other
+// processes, see KeyspaceNotifications and RootCacheTTL. By default the root is
+// read from Redis once and then only updated by the store's own writes.
+func WithRootInvalidation(mode RootInvalidation) Option {
+	return func(s *Storage) {
+		s.rootInvalidation = mode
+	}
+}
+
+// WithRootCache(false) disables the cached root: every GetRoot reads the root
+// from Redis, so processes sharing a tree always see its latest root, at the
+// cost of a round trip per call where a cached read takes nanoseconds. SetRoot
+// and the other root writes still write through to Redis. The cache is
+// enabled by default.
+func WithRootCache(enabled bool) Option {
+	return func(s *Storage) {
+		s.noRootCache = !enabled
+	}
+}
+
+// WithNodeCache keeps up to size recently read or written nodes in memory, so
+// repeated reads of the same node, such as the upper levels of a tree during
+// proof generation, don't go to Redis. Deletes through the store invalidate the
+// cache, but nodes deleted by another process or expired by a TTL may still be
+// served from it.
+func WithNodeCache(size int) Option {
+	return func(s *Storage) {
+		if size > 0 {
+			s.nodeCache = newNodeCache(size)
+		} else {
+			s.nodeCache = nil
+		}
+	}
+}
+
+// WithStrictSetRoot makes SetRoot check that the node of a non-empty root is
+// stored before setting it, returning an error wrapping ErrNodeNotFound
+// if it isn't. The check costs an extra round-trip per SetRoot.
+func WithStrictSetRoot(strict bool) Option {
+	return func(s *Storage) {
+		s.strictSetRoot = strict
+	}
+}
+
+// WithDatabase stores the tree in Redis database db instead of the database of
+// the client. The store creates its own clients for db from the options of the
+// given one, the read client and the failover secondary, which must be
+// *redis.Client; Close closes them. Redis Cluster only has database 0 and
+// doesn't support SELECT, so a cluster client is used as is, with a warning
+// logged, and NewMerkleRedisStorageChecked returns an error wrapping
+// ErrDatabaseUnsupported instead.
+func WithDatabase(db int) Option {
+	return func(s *Storage) {
+		s.database = db
+		s.selectDatabase = true
+	}
+}
+
+// WithNodeCounter maintains the number of nodes of the tree in a counter key,
+// so NodeCount doesn't have to scan the keyspace. See NodeCount for the
+// consistency guarantees of the counter.
+func WithNodeCounter() Option {
+	return func(s *Storage) {
+		s.nodeCounter = true
+	}
+}
+
+// WithClusterHashTag wraps the prefix in the key names in a Redis Cluster hash
+// tag ("mt_n_{prefix}_..."), so every key of the tree hashes to the same slot
+// and multi-key commands such as GetMulti, PutBatch and CommitRoot work on a
+// cluster. The trade-off is that the whole tree lives on a single node: its
+// memory and load are not spread across the cluster, and a busy tree makes that
+// node a hot spot. Enabling it changes the key names, so it can't be toggled on
+// existing data.
+func WithClusterHashTag(enabled bool) Option {
+	return func(s *Storage) {
+		s.clusterHashTag = enabled
+	}
+}
+
+// WithRetry retries Get, Put and SetRoot up to attempts times in total when
+// they fail with a transient error: a network error, or a LOADING, TRYAGAIN or
+// CLUSTERDOWN reply. The delay between attempts starts at backoff and doubles
+// after each one, up to 2s, and waiting stops early when the context is done.
+// Missing keys and corrupt values are never retried. With root history enabled,
+// a retried SetRoot whose first write reached Redis records the root twice.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(s *Storage) {
+		s.retryAttempts = attempts
+		s.retryBackoff = backoff
+	}
+}
+
+// WithMaxNodeBytes makes Put, PutBatch and CommitRoot reject nodes whose
+// serialized form, before compression and hex encoding, is larger than n bytes,
+// with an error wrapping ErrNodeTooLarge. Nothing is written when a node is
+// rejected. n <= 0, the default, sets no limit.
+func WithMaxNodeBytes(n int) Option {
+	return func(s *Storage) {
+		s.maxNodeBytes = n
+	}
+}
+
+// WithExtendedEntries lets PutEntry and GetEntry store and return leaf entries
+// of any length, for forks of go-merkletree-sql that keep extended leaf data
+// beyond the two elements. By default they accept only standard entries of
+// two elements. Get and the other operations on merkletree.Node values reject
+// extended entries either way, with an error wrapping
+// merkletree.ErrNodeBytesBadSize, as a node holds exactly two elements.
+func WithExtendedEntries(enabled bool) Option {
+	return func(s *Storage) {
+		s.extendedEntries = enabled
+	}
+}
+
+// WithScriptedAccess makes Get and Put read and write nodes with cached Lua
+// scripts run by EVALSHA, loaded with SCRIPT LOAD when the server doesn't have
+// them, instead of GET and SET. This suits ACL-restricted deployments that
+// grant scripting but not direct key access. It only covers Get and Put; the
+// other operations keep using their usual commands. On Redis Cluster, combining
+// it with WithNodeCounter requires WithClusterHashTag, as the script updates
+// the node and the counter together.
+func WithScriptedAccess(enabled bool) Option {
+	return func(s *Storage) {
+		s.scriptedAccess = enabled
+	}
+}
+
+// WithAsyncWrites makes Put and PutWithMeta queue nodes, up to bufferSize of
+// them, and return without waiting for Redis, for bulk ingestion. A background
+// goroutine writes the queued nodes in pipelines; Put only blocks while the
+// queue is full. Until Flush returns, Get may not find the queued nodes, and
+// their write errors are only reported by Flush, Close and the handler set with
+// WithAsyncErrorHandler. Close writes the remaining nodes and stops the
+// goroutine. Other writes, including PutBatch and SetRoot, stay synchronous,
+// so call Flush before setting a root that refers to queued nodes.
+func WithAsyncWrites(bufferSize int) Option {
+	return func(s *Storage) {
+		s.asyncBuffer = bufferSize
+	}
+}
+
+// WithAsyncErrorHandler calls fn with the error of every batch of nodes that
+// failed to be written in asynchronous mode, see WithAsyncWrites, from the
+// goroutine writing them. Without a handler they are reported to the logger
+// set with WithLogger.
+func WithAsyncErrorHandler(fn func(error)) Option {
+	return func(s *Storage) {
+		s.asyncErrorHandler = fn
+	}
+}
+
+// WithWAL keeps a write-ahead log in the local file at path, created if
+// missing, for deployments where Redis itself doesn't persist data. Put,
+// PutWithMeta, PutBatch, SetRoot and CommitRoot append their writes to it, and
+// sync it, before sending them, and mark them acknowledged once Redis confirms
+// them, or aborted if they fail. After a crash, Recover replays the writes that
+// were neither; Checkpoint truncates the log. The file is opened on first use
+// and closed by Close. Only one store may use a given file at a time.
+func WithWAL(path string) Option {
+	return func(s *Storage) {
+		s.wal = &wal{path: path}
+	}
+}
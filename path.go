@@ -0,0 +1,74 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// maxPathLevels bounds the walk of PathNodes by the number of bits in a key.
+const maxPathLevels = 8 * merkletree.ElemBytesLen
+
+// PathNodes returns the nodes on the path from the current root down to the
+// leaf whose index hash is leafKey, root first. The siblings needed for a proof
+// are the children of these nodes that are off the path, so only one node is
+// read per level.
+//
+// If the leaf is not in the tree, the path down to the empty subtree or to the
+// other leaf found in its place is returned along with
+// merkletree.ErrKeyNotFound; for an empty tree the path is empty. A node
+// missing from Redis is reported with an error wrapping merkletree.ErrNotFound.
+func (s *Storage) PathNodes(ctx context.Context, leafKey []byte) ([]*merkletree.Node, error) {
+	root, err := s.GetRoot(ctx)
+	if errors.Is(err, merkletree.ErrNotFound) {
+		return nil, merkletree.ErrKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return walkPath(root, leafKey, func(key *merkletree.Hash) (*merkletree.Node, error) {
+		return s.Get(ctx, key[:])
+	})
+}
+
+// walkPath walks the path from root down to the leaf whose index hash is
+// leafKey, reading each node with get, and reports it as PathNodes does.
+func walkPath(root *merkletree.Hash, leafKey []byte, get func(key *merkletree.Hash) (*merkletree.Node, error)) ([]*merkletree.Node, error) {
+	var path []*merkletree.Node
+	next := root
+	for level := 0; level < maxPathLevels; level++ {
+		if *next == merkletree.HashZero {
+			return path, merkletree.ErrKeyNotFound
+		}
+		node, err := get(next)
+		if errors.Is(err, merkletree.ErrNotFound) {
+			return path, newErr(err, "path node missing")
+		} else if err != nil {
+			return path, err
+		}
+		path = append(path, node)
+
+		switch node.Type {
+		case merkletree.NodeTypeLeaf:
+			if node.Entry[0] == nil || !bytes.Equal(node.Entry[0][:], leafKey) {
+				return path, merkletree.ErrKeyNotFound
+			}
+			return path, nil
+		case merkletree.NodeTypeMiddle:
+			if node.ChildL == nil || node.ChildR == nil {
+				return path, newErr(ErrCorruptNode, "middle node without children")
+			}
+			if merkletree.TestBit(leafKey, uint(level)) {
+				next = node.ChildR
+			} else {
+				next = node.ChildL
+			}
+		case merkletree.NodeTypeEmpty:
+			return path, merkletree.ErrKeyNotFound
+		default:
+			return path, newErr(ErrCorruptNode, "invalid node on path")
+		}
+	}
+	return path, merkletree.ErrReachedMaxLevel
+}
@@ -0,0 +1,69 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestPathNodes(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStorage(t, "path")
+
+	if path, err := s.PathNodes(ctx, testHash(1)[:]); len(path) != 0 || !errors.Is(err, merkletree.ErrKeyNotFound) {
+		t.Fatalf("empty tree: got %d nodes, %v", len(path), err)
+	}
+
+	mt := newTestTree(t, s, 8)
+	for _, k := range []int64{0, 3, 7} {
+		kHash, err := merkletree.NewHashFromBigInt(big.NewInt(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, err := s.PathNodes(ctx, kHash[:])
+		if err != nil {
+			t.Fatalf("key %d: %v", k, err)
+		}
+		proof, _, err := mt.GenerateProof(ctx, big.NewInt(k), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(path) != len(proof.AllSiblings())+1 {
+			t.Fatalf("key %d: got %d nodes for %d siblings", k, len(path), len(proof.AllSiblings()))
+		}
+		if h, _ := path[0].Key(); *h != *mt.Root() {
+			t.Fatalf("key %d: path doesn't start at the root", k)
+		}
+		leaf := path[len(path)-1]
+		if leaf.Type != merkletree.NodeTypeLeaf || *leaf.Entry[0] != *kHash {
+			t.Fatalf("key %d: path ends at %+v", k, leaf)
+		}
+		// each node is the child of the previous one on the key's side, and
+		// the other child is the proof sibling
+		for i, sib := range proof.AllSiblings() {
+			h, err := path[i+1].Key()
+			if err != nil {
+				t.Fatal(err)
+			}
+			child, other := path[i].ChildL, path[i].ChildR
+			if merkletree.TestBit(kHash[:], uint(i)) {
+				child, other = other, child
+			}
+			if *child != *h || *other != *sib {
+				t.Fatalf("key %d: level %d doesn't match the proof", k, i)
+			}
+		}
+	}
+
+	absent, _ := merkletree.NewHashFromBigInt(big.NewInt(100))
+	path, err := s.PathNodes(ctx, absent[:])
+	if !errors.Is(err, merkletree.ErrKeyNotFound) {
+		t.Fatalf("absent key: got %v, want ErrKeyNotFound", err)
+	}
+	if len(path) == 0 {
+		t.Fatal("absent key: expected the path to where it would be")
+	}
+}
@@ -0,0 +1,104 @@
+package merkleredis
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// defaultSeparator joins the prefix of a tree to its node keys and to the
+// prefixes derived from it, unless WithSeparator sets another.
+const defaultSeparator = "_"
+
+// ErrInvalidPrefix is returned by ValidatePrefix and the checked constructors
+// for a prefix, or separator, that would make key names ambiguous or break the
+// SCAN patterns matching them.
+var ErrInvalidPrefix = errors.New("invalid merkle tree prefix")
+
+// WithSeparator sets the separator between the prefix of the tree and its node
+// keys, and between the prefix and the suffix of a derived tree, see
+// WithPrefix and StorageFactory.Tree; "_" by default. The keys stored next to
+// the root, such as the node counter, keep their fixed suffixes. See
+// ValidatePrefix for the separators allowed.
+func WithSeparator(sep string) Option {
+	return func(s *Storage) {
+		s.separator = sep
+	}
+}
+
+// sep returns the separator set with WithSeparator, or defaultSeparator.
+func (s *Storage) sep() string {
+	if s.separator == "" {
+		return defaultSeparator
+	}
+	return s.separator
+}
+
+// separatorOf returns the separator a store created with opts uses, before
+// it is created.
+func separatorOf(opts []Option) string {
+	var configured Storage
+	for _, opt := range opts {
+		opt(&configured)
+	}
+	return configured.sep()
+}
+
+// ValidatePrefix returns an error wrapping ErrInvalidPrefix unless prefix can
+// name a tree unambiguously with the separator sep, as checked by
+// NewMerkleRedisStorageChecked. The prefix must be non-empty, must hold
+// neither "*" nor "#", which precedes the tree ID of
+// NewMerkleRedisStorageWithID, and may only hold sep escaped by a preceding
+// backslash, which stays part of the key names, so that the keys of one tree
+// never look like those of a tree derived from another. Other backslashes must
+// escape a character too. The separator must be non-empty and hold neither
+// "*", "#", a backslash nor lowercase hex digits, which node keys are encoded
+// with.
+func ValidatePrefix(prefix, sep string) error {
+	if sep == "" {
+		return newErr(ErrInvalidPrefix, "empty separator")
+	}
+	if strings.ContainsAny(sep, `*#\0123456789abcdef`) {
+		return newErr(ErrInvalidPrefix, fmt.Sprintf("separator %q holds a reserved character", sep))
+	}
+	if prefix == "" {
+		return newErr(ErrInvalidPrefix, "empty prefix")
+	}
+	if i := strings.IndexAny(prefix, "*#"); i >= 0 {
+		return newErr(ErrInvalidPrefix, fmt.Sprintf("prefix %q holds %c", prefix, prefix[i]))
+	}
+	for i := 0; i < len(prefix); {
+		switch {
+		case prefix[i] == '\\':
+			if i+1 == len(prefix) {
+				return newErr(ErrInvalidPrefix, fmt.Sprintf("prefix %q ends in a backslash", prefix))
+			}
+			if strings.HasPrefix(prefix[i+1:], sep) {
+				i += 1 + len(sep)
+			} else {
+				i += 2
+			}
+		case strings.HasPrefix(prefix[i:], sep):
+			return newErr(ErrInvalidPrefix, fmt.Sprintf("prefix %q holds the separator %q unescaped", prefix, sep))
+		default:
+			i++
+		}
+	}
+	return nil
+}
+
+// globEscape escapes the characters of s that SCAN patterns give a special
+// meaning, so that the pattern matches s literally.
+func globEscape(s string) string {
+	if !strings.ContainsAny(s, `*?[]\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(`*?[]\`, s[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+)
+
+func TestValidatePrefix(t *testing.T) {
+	for _, c := range []struct {
+		prefix, sep string
+		ok          bool
+	}{
+		{"tree", "_", true},
+		{"tree:v1", "_", true},
+		{`tree\_v1`, "_", true},
+		{"tree_v1", ":", true},
+		{`tree\::v1`, "::", true},
+		{"", "_", false},
+		{"*", "_", false},
+		{"tree*", "_", false},
+		{"a#1", "_", false},
+		{"tree", "#", false},
+		{"tree_v1", "_", false},
+		{"tree_", "_", false},
+		{"tree::v1", "::", false},
+		{`tree\`, "_", false},
+		{"tree", "", false},
+		{"tree", "*", false},
+		{"tree", "-a-", false},
+	} {
+		err := ValidatePrefix(c.prefix, c.sep)
+		if c.ok && err != nil {
+			t.Errorf("ValidatePrefix(%q, %q) = %v", c.prefix, c.sep, err)
+		} else if !c.ok && !errors.Is(err, ErrInvalidPrefix) {
+			t.Errorf("ValidatePrefix(%q, %q) = %v, want ErrInvalidPrefix", c.prefix, c.sep, err)
+		}
+	}
+}
+
+func TestCheckedConstructorRejectsPrefix(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+
+	if _, err := NewMerkleRedisStorageChecked(ctx, srv.Client(t), "a_b"); !errors.Is(err, ErrInvalidPrefix) {
+		t.Fatalf("got %v, want ErrInvalidPrefix", err)
+	}
+	if srv.Count("PING") != 0 {
+		t.Fatal("pinged with an invalid prefix")
+	}
+	if _, err := NewMerkleRedisStorageChecked(ctx, srv.Client(t), "a_b", WithSeparator(":")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSeparator(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "sep", WithSeparator(":"))
+	if s.nodeIdPrefix != "mt_n_sep:" {
+		t.Fatalf("node key prefix %q", s.nodeIdPrefix)
+	}
+
+	child := s.WithPrefix("child")
+	if child.prefix != "sep:child" {
+		t.Fatalf("derived prefix %q", child.prefix)
+	}
+	if tree := NewStorageFactory(srv.Client(t), "sep", WithSeparator(":")).Tree("x"); tree.prefix != "sep:x" {
+		t.Fatalf("factory prefix %q", tree.prefix)
+	}
+
+	// Reset tells the nodes of the derived tree apart by the separator
+	kvs := testLeafKVs(3)
+	if err := s.PutBatch(ctx, kvs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := child.PutBatch(ctx, kvs[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{s.rootId + versionSuffix, child.getRedisNodeIdForMerkleKey(kvs[2].K)}
+	keys := srv.Keys()
+	sort.Strings(keys)
+	sort.Strings(want)
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("Reset left %v, want %v", keys, want)
+	}
+}
+
+func TestEscapedPrefix(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	escaped := NewMerkleRedisStorage(srv.Client(t), `a\_b`)
+	plain := NewMerkleRedisStorage(srv.Client(t), "a")
+
+	if err := escaped.PutBatch(ctx, testLeafKVs(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.WithPrefix("b").PutBatch(ctx, testLeafKVs(3)); err != nil {
+		t.Fatal(err)
+	}
+	// the backslash is matched literally, not as an escape of the separator
+	if kvs, err := escaped.List(ctx, 0); err != nil || len(kvs) != 2 {
+		t.Fatalf("List: got %d nodes, %v, want 2", len(kvs), err)
+	}
+}
@@ -0,0 +1,163 @@
+package merkleredis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// Promote replaces the tree of this store with the tree stored under
+// fromPrefix, typically a staging tree built by a re-indexing job with the same
+// options as this store. The nodes of the staging tree are moved to this
+// store's prefix first, and its root last, in a single command, so readers see
+// either the old tree or the complete new one: nodes are keyed by their hash,
+// so moving them doesn't change what the old root refers to. Nodes of the old
+// tree that aren't part of the new one are left in place; call Reset beforehand
+// or clean them up separately if they aren't needed. The staging tree is gone
+// afterwards, while trees derived from it with WithPrefix stay in place.
+// Promote returns an error wrapping ErrRootNotFound if the staging tree has no
+// root, and doesn't move anything in that case.
+//
+// Keys are moved with pipelined RENAME commands. On Redis Cluster the staging
+// and live keys generally hash to different slots, where RENAME is refused, so
+// they are copied and then deleted instead, and the store's TTL is applied to
+// the copies. If Promote fails part way, the nodes moved so far are harmless to
+// the live tree and calling it again moves the rest.
+func (s *Storage) Promote(ctx context.Context, fromPrefix string) error {
+	fromNodeIdPrefix, fromRootId := s.keyNames(fromPrefix)
+	v, err := s.readRaw(ctx, fromRootId)
+	if err == redis.Nil {
+		return newErr(ErrRootNotFound, "staging root not found")
+	} else if err != nil {
+		return newErr(err, "failed to read staging root")
+	}
+	var root merkletree.Hash
+	if err := s.decodeRoot(fromRootId, v, &root); err != nil {
+		return err
+	}
+
+	err = s.scanTreeNodeKeys(ctx, fromNodeIdPrefix, func(keys []string) error {
+		to := make([]string, len(keys))
+		for i, k := range keys {
+			to[i] = s.nodeIdPrefix + strings.TrimPrefix(k, fromNodeIdPrefix)
+		}
+		return s.moveKeys(ctx, keys, to)
+	})
+	if err != nil {
+		return err
+	}
+
+	// the root carries its SetRoot timestamp and format version along, if it
+	// has them; those of the old root must not outlive it
+	s.rootMu.Lock()
+	err = s.deleteKeys(ctx, []string{s.rootId + rootTimestampSuffix, s.rootId + formatSuffix})
+	if err == nil {
+		err = s.moveKeys(ctx,
+			[]string{fromRootId, fromRootId + rootTimestampSuffix, fromRootId + formatSuffix},
+			[]string{s.rootId, s.rootId + rootTimestampSuffix, s.rootId + formatSuffix})
+	}
+	if err == nil {
+		s.cacheRoot(&root)
+		err = s.recordRootWrite(ctx, v)
+	}
+	s.rootMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.deleteKeys(ctx, []string{fromRootId + nodeCountSuffix, fromRootId + rootHistorySuffix, fromRootId + versionSuffix}); err != nil {
+		return err
+	}
+	if s.nodeCounter {
+		if _, err := s.RebuildNodeCount(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRaw reads the value at key from the primary client.
+func (s *Storage) readRaw(ctx context.Context, key string) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return s.db.Get(ctx, key).Result()
+}
+
+// writeRaw writes the value read by readRaw to key, applying the store's TTL.
+func (s *Storage) writeRaw(ctx context.Context, key, v string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return s.db.Set(ctx, key, v, s.ttl).Err()
+}
+
+// moveKeys moves each key in from to the key at the same index in to,
+// replacing it. Keys that disappear in the meantime are skipped.
+func (s *Storage) moveKeys(ctx context.Context, from, to []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, ok := s.db.(*redis.ClusterClient); ok {
+		if err := s.copyKeys(ctx, from, to); err != nil {
+			return err
+		}
+		return s.deleteKeys(ctx, from)
+	}
+	pipe := s.db.Pipeline()
+	cmds := make([]*redis.StatusCmd, len(from))
+	for i := range from {
+		cmds[i] = pipe.Rename(ctx, from[i], to[i])
+	}
+	// errors are checked per command, to tolerate missing keys
+	_, _ = pipe.Exec(ctx)
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && !isNoSuchKey(err) {
+			return newErr(err, "failed to move keys")
+		}
+	}
+	return nil
+}
+
+// copyKeys copies the value of each key in from to the key at the same index
+// in to, applying the store's TTL. Keys that disappear in the meantime are
+// skipped.
+func (s *Storage) copyKeys(ctx context.Context, from, to []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	pipe := s.db.Pipeline()
+	gets := make([]*redis.StringCmd, len(from))
+	for i, k := range from {
+		gets[i] = pipe.Get(ctx, k)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return newErr(err, "failed to read keys")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	pipe = s.db.Pipeline()
+	for i, cmd := range gets {
+		if cmd.Err() == redis.Nil {
+			continue
+		}
+		pipe.Set(ctx, to[i], cmd.Val(), s.ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return newErr(err, "failed to write keys")
+	}
+	return nil
+}
+
+// isNoSuchKey reports whether err is the error RENAME returns for a missing
+// source key.
+func isNoSuchKey(err error) bool {
+	return strings.HasPrefix(err.Error(), "ERR no such key")
+}
@@ -0,0 +1,94 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestPromote(t *testing.T) {
+	ctx := context.Background()
+	live, srv := newTestStorage(t, "live")
+	newTestTree(t, live, 3)
+	staging := NewMerkleRedisStorageUniversal(live.db, "live_staging")
+	want := newTestTree(t, staging, 8)
+
+	if err := live.Promote(ctx, "live_staging"); err != nil {
+		t.Fatal(err)
+	}
+	checkPromoted(t, live, want)
+	if _, ts, err := live.GetRootWithTimestamp(ctx); err != nil || ts.IsZero() {
+		t.Fatalf("got timestamp %v, %v; want the staging root's", ts, err)
+	}
+	for _, k := range srv.Keys() {
+		if strings.Contains(k, "live_staging") {
+			t.Fatalf("staging key %q left behind", k)
+		}
+	}
+	fresh := NewMerkleRedisStorageUniversal(live.db, "live_staging")
+	if _, err := fresh.GetRoot(ctx); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("staging root: got %v, want ErrNotFound", err)
+	}
+
+	if err := live.Promote(ctx, "live_staging"); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("promoting a missing tree: got %v, want ErrNotFound", err)
+	}
+	checkPromoted(t, live, want)
+}
+
+func TestPromoteCluster(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	client := srv.ClusterClient(t)
+	live := NewMerkleRedisStorageUniversal(client, "live", WithClusterHashTag(true), WithNodeCounter())
+	newTestTree(t, live, 3)
+	staging := NewMerkleRedisStorageUniversal(client, "staging", WithClusterHashTag(true))
+	want := newTestTree(t, staging, 8)
+
+	if err := live.Promote(ctx, "staging"); err != nil {
+		t.Fatal(err)
+	}
+	checkPromoted(t, live, want)
+	n, err := live.NodeCount(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scanned, _ := live.scanNodeCount(ctx); n != scanned {
+		t.Fatalf("node count: got %d, want %d", n, scanned)
+	}
+}
+
+// checkPromoted checks that a fresh store reading the tree of s sees the root
+// of want and can prove its entries.
+func checkPromoted(t *testing.T, s *Storage, want *merkletree.MerkleTree) {
+	t.Helper()
+	ctx := context.Background()
+	fresh := NewMerkleRedisStorageUniversal(s.db, s.prefix, s.opts...)
+	for _, st := range []*Storage{s, fresh} {
+		root, err := st.GetRoot(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *root != *want.Root() {
+			t.Fatalf("root: got %v, want %v", root, want.Root())
+		}
+	}
+	mt, err := merkletree.NewMerkleTree(ctx, fresh, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 8; i++ {
+		p, _, err := mt.GenerateProof(ctx, big.NewInt(i), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.Existence {
+			t.Fatalf("entry %d: no existence proof", i)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// maxRetryBackoff caps the delay between retries, unless the configured
+// initial backoff is already larger.
+const maxRetryBackoff = 2 * time.Second
+
+// retryablePrefixes are the redis error replies that report a transient
+// server condition.
+var retryablePrefixes = []string{"LOADING", "TRYAGAIN", "CLUSTERDOWN"}
+
+// retry runs op up to the number of attempts configured by WithRetry, for as
+// long as it fails with a retryable error, sleeping an exponentially growing
+// backoff in between. It returns the last error, or the error of ctx if it is
+// done while waiting.
+func (s *Storage) retry(ctx context.Context, op func() error) error {
+	delay := s.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= s.retryAttempts || !isRetryable(err) {
+			return err
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		if delay *= 2; delay > maxRetryBackoff {
+			delay = maxRetryBackoff
+			if s.retryBackoff > delay {
+				delay = s.retryBackoff
+			}
+		}
+	}
+}
+
+// isRetryable reports whether err is a transient failure worth retrying:
+// network errors, connections closed by the server, and LOADING, TRYAGAIN and
+// CLUSTERDOWN replies. Missing keys, corrupt values and context errors are not.
+func isRetryable(err error) bool {
+	if err == redis.Nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		for _, p := range retryablePrefixes {
+			if strings.HasPrefix(redisErr.Error(), p) {
+				return true
+			}
+		}
+	}
+	return false
+}
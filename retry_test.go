@@ -0,0 +1,129 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// replyError is an error reply from the server.
+type replyError string
+
+func (e replyError) Error() string { return string(e) }
+
+func (replyError) RedisError() {}
+
+// flakyClient fails the first failures reads and writes with err, then passes
+// them on to the embedded client.
+type flakyClient struct {
+	redis.UniversalClient
+	failures int32
+	err      error
+	calls    int32
+}
+
+func (c *flakyClient) fail() bool {
+	return atomic.AddInt32(&c.calls, 1) <= c.failures
+}
+
+func (c *flakyClient) Get(ctx context.Context, key string) *redis.StringCmd {
+	if c.fail() {
+		cmd := redis.NewStringCmd(ctx, "get", key)
+		cmd.SetErr(c.err)
+		return cmd
+	}
+	return c.UniversalClient.Get(ctx, key)
+}
+
+func (c *flakyClient) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.StatusCmd {
+	if c.fail() {
+		cmd := redis.NewStatusCmd(ctx, "set", key, value)
+		cmd.SetErr(c.err)
+		return cmd
+	}
+	return c.UniversalClient.Set(ctx, key, value, ttl)
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		{"network", &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}},
+		{"loading", replyError("LOADING Redis is loading the dataset in memory")},
+		{"tryagain", replyError("TRYAGAIN Multiple keys request during rehashing of slot")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := fakeredis.New(t)
+			client := &flakyClient{UniversalClient: srv.Client(t), err: tc.err}
+			s := NewMerkleRedisStorageUniversal(client, "retry", WithRetry(3, time.Millisecond))
+			node := merkletree.NewNodeLeaf(testHash(1), testHash(2))
+
+			client.failures, client.calls = 2, 0
+			if err := s.Put(ctx, []byte("k"), node); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			client.failures, client.calls = 2, 0
+			if err := s.SetRoot(ctx, testHash(3)); err != nil {
+				t.Fatalf("SetRoot: %v", err)
+			}
+			client.failures, client.calls = 2, 0
+			if _, err := s.Get(ctx, []byte("k")); err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if client.calls != 3 {
+				t.Fatalf("Get: got %d calls, want 3", client.calls)
+			}
+
+			client.failures, client.calls = 3, 0
+			if _, err := s.Get(ctx, []byte("k")); !errors.Is(err, tc.err) {
+				t.Fatalf("Get after exhausting attempts: got %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestRetrySkipsPermanentErrors(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	client := &flakyClient{UniversalClient: srv.Client(t)}
+	s := NewMerkleRedisStorageUniversal(client, "retry", WithRetry(5, time.Millisecond))
+
+	if _, err := s.Get(ctx, []byte("missing")); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	if client.calls != 1 {
+		t.Fatalf("missing key: got %d calls, want 1", client.calls)
+	}
+
+	client.failures, client.calls, client.err = 5, 0, replyError("ERR wrong number of arguments")
+	if _, err := s.Get(ctx, []byte("k")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if client.calls != 1 {
+		t.Fatalf("permanent error: got %d calls, want 1", client.calls)
+	}
+}
+
+func TestRetryHonoursContext(t *testing.T) {
+	srv := fakeredis.New(t)
+	client := &flakyClient{UniversalClient: srv.Client(t), failures: 100, err: replyError("LOADING")}
+	s := NewMerkleRedisStorageUniversal(client, "retry", WithRetry(100, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.Get(ctx, []byte("k")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if client.calls != 1 {
+		t.Fatalf("got %d calls, want 1", client.calls)
+	}
+}
@@ -0,0 +1,261 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// rootHistorySuffix is appended to the root key to form the root history list.
+const rootHistorySuffix = "_hist"
+
+// rootTimestampSuffix is appended to the root key to form the key holding the
+// time the root was last written, in Unix nanoseconds.
+const rootTimestampSuffix = "_ts"
+
+// commitRootScript writes every node in KEYS[1..n], then the root in KEYS[n+1]
+// and its timestamp in KEYS[n+2], with ARGV holding the matching values
+// followed by the TTL in milliseconds. Arguments are validated before anything
+// is written so a bad call leaves the tree untouched.
+var commitRootScript = redis.NewScript(`
+local n = #KEYS - 2
+if n < 0 or #ARGV ~= n + 3 then
+	return redis.error_reply('ERR commit root: expected one value per key and a TTL')
+end
+local ttl = tonumber(ARGV[n + 3])
+if ttl == nil or ttl < 0 then
+	return redis.error_reply('ERR commit root: invalid TTL')
+end
+for i = 1, n + 2 do
+	if ttl > 0 then
+		redis.call('SET', KEYS[i], ARGV[i], 'PX', ttl)
+	else
+		redis.call('SET', KEYS[i], ARGV[i])
+	end
+end
+return n
+`)
+
+// compareAndSetRootScript sets the root in KEYS[1] to ARGV[2], and its
+// timestamp in KEYS[2] to ARGV[3], only if the root currently holds ARGV[1], or
+// is missing and ARGV[1] is empty. ARGV[4] is the TTL in milliseconds. It
+// returns 1 if it set the root and 0 otherwise.
+var compareAndSetRootScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if cur == false then
+	cur = ''
+end
+if cur ~= ARGV[1] then
+	return 0
+end
+local ttl = tonumber(ARGV[4])
+for i = 1, 2 do
+	if ttl > 0 then
+		redis.call('SET', KEYS[i], ARGV[i + 1], 'PX', ttl)
+	else
+		redis.call('SET', KEYS[i], ARGV[i + 1])
+	end
+end
+return 1
+`)
+
+// CompareAndSetRoot sets the root to new only if the stored root is still
+// expected, or there is no root and expected is nil, so that concurrent
+// writers that derived their roots from the same one can't silently overwrite
+// each other's work. It reports whether the root was set; on a mismatch the
+// caller should reload the root, reapply its changes and try again. The check
+// and the write run as a single server-side script; on Redis Cluster the root
+// and its timestamp key must hash to the same slot, see WithClusterHashTag.
+func (s *Storage) CompareAndSetRoot(ctx context.Context, expected, new *merkletree.Hash) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var want interface{} = ""
+	if expected != nil {
+		var err error
+		if want, err = s.encodeRoot(expected); err != nil {
+			return false, err
+		}
+	}
+	v, err := s.encodeRoot(new)
+	if err != nil {
+		return false, err
+	}
+	keys := []string{s.rootId, s.rootId + rootTimestampSuffix}
+	if err := s.recordFormat(ctx); err != nil {
+		return false, err
+	}
+
+	s.rootMu.Lock()
+	defer s.rootMu.Unlock()
+	set, err := compareAndSetRootScript.Run(ctx, s.db, keys,
+		want, v, time.Now().UnixNano(), s.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, newErr(err, "failed to compare and set root")
+	}
+	if set == 0 {
+		// the cached root, if any, is stale
+		s.currentRoot = nil
+		s.rootGen++
+		return false, nil
+	}
+	s.cacheRoot(new)
+	if err := s.recordRootWrite(ctx, v); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// CommitRoot atomically writes nodes and then sets root as the current root,
+// along with its timestamp, so a crashed writer never leaves the root pointing
+// at a missing node. It runs as a single server-side script; on Redis Cluster
+// all keys must hash to the same slot, see WithClusterHashTag.
+func (s *Storage) CommitRoot(ctx context.Context, root *merkletree.Hash, nodes []KV) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	keys := make([]string, 0, len(nodes)+1)
+	args := make([]interface{}, 0, len(nodes)+2)
+	var items []*NodeItem
+	for i := range nodes {
+		item, err := NewNodeItemFromNode(nodes[i].K, &nodes[i].V)
+		if err != nil {
+			return err
+		}
+		v, err := s.encodeNodeItem(item)
+		if err != nil {
+			return err
+		}
+		if s.wal != nil {
+			items = append(items, item)
+		}
+		keys = append(keys, s.getRedisNodeIdForMerkleKey(nodes[i].K))
+		args = append(args, v)
+	}
+	v, err := s.encodeRoot(root)
+	if err != nil {
+		return err
+	}
+	keys = append(keys, s.rootId, s.rootId+rootTimestampSuffix)
+	args = append(args, v, time.Now().UnixNano(), s.ttl.Milliseconds())
+
+	if err := s.recordFormat(ctx); err != nil {
+		return err
+	}
+	seq, err := s.logWrites(items, root)
+	if err != nil {
+		return err
+	}
+	s.rootMu.Lock()
+	defer s.rootMu.Unlock()
+	if err := commitRootScript.Run(ctx, s.db, keys, args...).Err(); err != nil {
+		return s.abortWrites(seq, newErr(err, "failed to commit root"))
+	}
+	if err := s.wal.ack(seq); err != nil {
+		return err
+	}
+	for i := range nodes {
+		s.nodeCache.add(nodes[i].K, &nodes[i].V)
+	}
+	s.cacheRoot(root)
+	if err := s.recordRootWrite(ctx, v); err != nil {
+		return err
+	}
+	return nil
+}
+
+// pushRootHistory queues the commands recording the root value v, as returned
+// by encodeRoot, at the head of the capped root history list.
+func (s *Storage) pushRootHistory(ctx context.Context, pipe redis.Pipeliner, v interface{}) {
+	histId := s.rootId + rootHistorySuffix
+	pipe.LPush(ctx, histId, v)
+	pipe.LTrim(ctx, histId, 0, int64(s.rootHistory-1))
+	if s.ttl > 0 {
+		pipe.Expire(ctx, histId, s.ttl)
+	}
+}
+
+// GetRootHistory returns the roots recorded by SetRoot, newest first. Roots
+// are only recorded when the store is created with WithRootHistory.
+func (s *Storage) GetRootHistory(ctx context.Context) ([]*merkletree.Hash, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	vals, err := s.db.LRange(ctx, s.rootId+rootHistorySuffix, 0, -1).Result()
+	if err != nil {
+		return nil, newErr(err, "failed to read root history")
+	}
+	roots := make([]*merkletree.Hash, 0, len(vals))
+	for _, v := range vals {
+		var root merkletree.Hash
+		if err := s.decodeRoot(s.rootId+rootHistorySuffix, v, &root); err != nil {
+			return nil, err
+		}
+		roots = append(roots, &root)
+	}
+	return roots, nil
+}
+
+// RevertRoot sets the current root back to target, which must be one of the
+// roots in the history kept by WithRootHistory. The revert is itself recorded
+// in the history like any other SetRoot.
+func (s *Storage) RevertRoot(ctx context.Context, target *merkletree.Hash) error {
+	hist, err := s.GetRootHistory(ctx)
+	if err != nil {
+		return err
+	}
+	for _, root := range hist {
+		if *root == *target {
+			return s.SetRoot(ctx, target)
+		}
+	}
+	return newErr(merkletree.ErrNotFound, "root not found in history")
+}
+
+// PreloadRoot loads the root into the cache, so that the first GetRoot doesn't
+// have to go to Redis. An empty tree is not an error.
+func (s *Storage) PreloadRoot(ctx context.Context) error {
+	_, err := s.GetRoot(ctx)
+	if errors.Is(err, merkletree.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// GetRootWithTimestamp returns the current root along with the time it was
+// written by SetRoot, CompareAndSetRoot, CommitRoot or a Txn, which Promote
+// carries over from the staging tree, reading both from Redis in one pipeline
+// rather than from the root cache. The time is zero if the root was written
+// some other way, such as by Clone or a release that didn't record it. It
+// returns ErrRootNotFound if there is no root.
+func (s *Storage) GetRootWithTimestamp(ctx context.Context) (*merkletree.Hash, time.Time, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	pipe := s.reader().Pipeline()
+	rootCmd := pipe.Get(ctx, s.rootId)
+	tsCmd := pipe.Get(ctx, s.rootId+rootTimestampSuffix)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, time.Time{}, newErr(err, "failed to read root")
+	}
+	if rootCmd.Err() == redis.Nil {
+		return nil, time.Time{}, ErrRootNotFound
+	}
+	var root merkletree.Hash
+	if err := s.decodeRoot(s.rootId, rootCmd.Val(), &root); err != nil {
+		return nil, time.Time{}, err
+	}
+	if tsCmd.Err() == redis.Nil {
+		return &root, time.Time{}, nil
+	}
+	ns, err := strconv.ParseInt(tsCmd.Val(), 10, 64)
+	if err != nil {
+		return nil, time.Time{}, newErr(ErrCorruptRoot, fmt.Sprintf("invalid timestamp in %s", s.rootId+rootTimestampSuffix))
+	}
+	return &root, time.Unix(0, ns), nil
+}
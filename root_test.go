@@ -0,0 +1,360 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func init() {
+	fakeredis.RegisterScript(commitRootScript.Hash(), func(c *fakeredis.Conn, keys, argv [][]byte) {
+		n := len(keys) - 2
+		if n < 0 || len(argv) != n+3 {
+			c.WriteError("ERR commit root: expected one value per key and a TTL")
+			return
+		}
+		ttl, err := strconv.ParseInt(string(argv[n+2]), 10, 64)
+		if err != nil || ttl < 0 {
+			c.WriteError("ERR commit root: invalid TTL")
+			return
+		}
+		for i := 0; i <= n+1; i++ {
+			c.Srv.SetString(string(keys[i]), argv[i], time.Duration(ttl)*time.Millisecond)
+		}
+		c.WriteInt(int64(n))
+	})
+	fakeredis.RegisterScript(compareAndSetRootScript.Hash(), func(c *fakeredis.Conn, keys, argv [][]byte) {
+		var cur []byte
+		if v := c.Srv.Lookup(string(keys[0])); v != nil {
+			cur = v.Str
+		}
+		if !bytes.Equal(cur, argv[0]) {
+			c.WriteInt(0)
+			return
+		}
+		ttl, _ := strconv.ParseInt(string(argv[3]), 10, 64)
+		for i := 0; i < 2; i++ {
+			c.Srv.SetString(string(keys[i]), argv[i+1], time.Duration(ttl)*time.Millisecond)
+		}
+		c.WriteInt(1)
+	})
+}
+
+func TestCommitRoot(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "commit")
+
+	kvs := testLeafKVs(5)
+	if err := s.CommitRoot(ctx, testHash(7), kvs); err != nil {
+		t.Fatal(err)
+	}
+	fresh := NewMerkleRedisStorage(srv.Client(t), "commit")
+	root, err := fresh.GetRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *root != *testHash(7) {
+		t.Fatalf("root: got %x", root[:])
+	}
+	for _, kv := range kvs {
+		if _, err := fresh.Get(ctx, kv.K); err != nil {
+			t.Fatalf("node %x: %v", kv.K, err)
+		}
+	}
+}
+
+func TestCommitRootFailureLeavesRoot(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStorage(t, "commit")
+	if err := s.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs := testLeafKVs(3)
+	keys := []string{s.getRedisNodeIdForMerkleKey(kvs[0].K), s.rootId, s.rootId + rootTimestampSuffix}
+	item, err := NewNodeItemFromNode(kvs[0].K, &kvs[0].V)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := MarshalNodeItem(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a TTL the script can't parse aborts it
+	err = commitRootScript.Run(ctx, s.db, keys, d, testHash(2)[:], time.Now().UnixNano(), "bogus").Err()
+	if err == nil {
+		t.Fatal("expected the script to fail")
+	}
+
+	fresh := NewMerkleRedisStorageUniversal(s.db, "commit")
+	root, err := fresh.GetRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *root != *testHash(1) {
+		t.Fatalf("root changed to %x", root[:])
+	}
+	if _, err := fresh.Get(ctx, kvs[0].K); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("node written despite failure: %v", err)
+	}
+}
+
+func TestRootHistory(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "hist", WithRootHistory(3))
+
+	for i := byte(1); i <= 5; i++ {
+		if err := s.SetRoot(ctx, testHash(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hist, err := s.GetRootHistory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{5, 4, 3}
+	if len(hist) != len(want) {
+		t.Fatalf("got %d roots, want %d", len(hist), len(want))
+	}
+	for i, b := range want {
+		if *hist[i] != *testHash(b) {
+			t.Fatalf("history[%d]: got %x, want %x", i, hist[i][:], testHash(b)[:])
+		}
+	}
+
+	noHist := NewMerkleRedisStorage(srv.Client(t), "nohist")
+	if err := noHist.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	if hist, err := noHist.GetRootHistory(ctx); err != nil || len(hist) != 0 {
+		t.Fatalf("got %v, %v; want no history", hist, err)
+	}
+}
+
+func TestRevertRoot(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "revert", WithRootHistory(10))
+
+	for i := byte(1); i <= 3; i++ {
+		if err := s.SetRoot(ctx, testHash(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.RevertRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	root, err := s.GetRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *root != *testHash(1) {
+		t.Fatalf("got root %x after revert", root[:])
+	}
+	fresh := NewMerkleRedisStorageUniversal(s.db, "revert")
+	if root, err := fresh.GetRoot(ctx); err != nil || *root != *testHash(1) {
+		t.Fatalf("stored root: got %v, %v", root, err)
+	}
+
+	err = s.RevertRoot(ctx, testHash(9))
+	if !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("unknown target: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestPreloadRoot(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+
+	empty := NewMerkleRedisStorage(srv.Client(t), "preload")
+	if err := empty.PreloadRoot(ctx); err != nil {
+		t.Fatalf("PreloadRoot on an empty tree: %v", err)
+	}
+
+	if err := empty.SetRoot(ctx, testHash(3)); err != nil {
+		t.Fatal(err)
+	}
+	s := NewMerkleRedisStorage(srv.Client(t), "preload")
+	if err := s.PreloadRoot(ctx); err != nil {
+		t.Fatal(err)
+	}
+	gets := srv.Count("GET")
+	root, err := s.GetRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *root != *testHash(3) {
+		t.Fatalf("root: got %x", root[:])
+	}
+	if n := srv.Count("GET"); n != gets {
+		t.Fatalf("GetRoot sent %d GET commands after PreloadRoot", n-gets)
+	}
+}
+
+func TestStrictSetRoot(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	strict := NewMerkleRedisStorage(srv.Client(t), "strict", WithStrictSetRoot(true))
+	permissive := NewMerkleRedisStorage(srv.Client(t), "strict")
+
+	dangling := testHash(1)
+	if err := strict.SetRoot(ctx, dangling); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("strict SetRoot of a dangling root: got %v, want ErrNotFound", err)
+	}
+	if _, ok := srv.Raw(strict.rootId); ok {
+		t.Fatal("rejected root was stored")
+	}
+	if _, err := strict.GetRoot(ctx); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("GetRoot after a rejected SetRoot: got %v, want ErrNotFound", err)
+	}
+	if err := permissive.SetRoot(ctx, dangling); err != nil {
+		t.Fatalf("permissive SetRoot of a dangling root: %v", err)
+	}
+
+	if err := strict.SetRoot(ctx, &merkletree.HashZero); err != nil {
+		t.Fatalf("strict SetRoot of the empty root: %v", err)
+	}
+	node := merkletree.NewNodeMiddle(testHash(2), testHash(3))
+	key, err := node.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := strict.Put(ctx, key[:], node); err != nil {
+		t.Fatal(err)
+	}
+	if err := strict.SetRoot(ctx, key); err != nil {
+		t.Fatalf("strict SetRoot of a stored root: %v", err)
+	}
+}
+
+func TestShortRoot(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "short", WithRootHistory(2))
+	short := bytes.Repeat([]byte{0xab}, 16)
+	srv.SetRaw(s.rootId, short)
+
+	if root, err := s.GetRoot(ctx); !errors.Is(err, ErrCorruptRoot) {
+		t.Fatalf("GetRoot: got %v, %v, want ErrCorruptRoot", root, err)
+	}
+	if err := s.PreloadRoot(ctx); !errors.Is(err, ErrCorruptRoot) {
+		t.Fatalf("PreloadRoot: got %v, want ErrCorruptRoot", err)
+	}
+
+	staging := NewMerkleRedisStorageUniversal(s.db, "short_staging")
+	srv.SetRaw(staging.rootId, short)
+	if err := s.Promote(ctx, "short_staging"); !errors.Is(err, ErrCorruptRoot) {
+		t.Fatalf("Promote: got %v, want ErrCorruptRoot", err)
+	}
+
+	if err := s.db.LPush(ctx, s.rootId+rootHistorySuffix, short).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if hist, err := s.GetRootHistory(ctx); !errors.Is(err, ErrCorruptRoot) {
+		t.Fatalf("GetRootHistory: got %v, %v, want ErrCorruptRoot", hist, err)
+	}
+}
+
+func TestGetRootWithTimestamp(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "ts")
+	if _, _, err := s.GetRootWithTimestamp(ctx); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("no root: got %v, want ErrNotFound", err)
+	}
+
+	var last time.Time
+	for i := byte(1); i <= 3; i++ {
+		before := time.Now()
+		if err := s.SetRoot(ctx, testHash(i)); err != nil {
+			t.Fatal(err)
+		}
+		root, ts, err := s.GetRootWithTimestamp(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *root != *testHash(i) {
+			t.Fatalf("root: got %v, want %v", root, testHash(i))
+		}
+		if !ts.After(last) || ts.Before(before) || ts.After(time.Now()) {
+			t.Fatalf("SetRoot %d: timestamp %v doesn't advance past %v within the call", i, ts, last)
+		}
+		last = ts
+		time.Sleep(time.Millisecond)
+	}
+
+	// CommitRoot replaces the timestamp of the previous root
+	if err := s.CommitRoot(ctx, testHash(9), nil); err != nil {
+		t.Fatal(err)
+	}
+	root, ts, err := s.GetRootWithTimestamp(ctx)
+	if err != nil || *root != *testHash(9) || !ts.After(last) {
+		t.Fatalf("got %v, %v, %v; want the committed root after %v", root, ts, err, last)
+	}
+
+	// roots written without a timestamp report the zero time
+	if err := s.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetRaw(s.rootId, testHash(8)[:])
+	root, ts, err = s.GetRootWithTimestamp(ctx)
+	if err != nil || *root != *testHash(8) || !ts.IsZero() {
+		t.Fatalf("got %v, %v, %v; want the raw root and no timestamp", root, ts, err)
+	}
+}
+
+func TestCompareAndSetRoot(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"raw", nil},
+		{"hex", []Option{WithHexEncoding(), WithRootHistory(5)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewMerkleRedisStorage(srv.Client(t), "cas_"+tc.name, tc.opts...)
+			b := NewMerkleRedisStorage(srv.Client(t), "cas_"+tc.name, tc.opts...)
+
+			if ok, err := a.CompareAndSetRoot(ctx, testHash(1), testHash(2)); err != nil || ok {
+				t.Fatalf("CAS on a missing root with an expected one: got %v, %v", ok, err)
+			}
+			if ok, err := a.CompareAndSetRoot(ctx, nil, testHash(1)); err != nil || !ok {
+				t.Fatalf("CAS on a missing root: got %v, %v", ok, err)
+			}
+
+			// both writers start from root 1, b commits first
+			base, err := a.GetRoot(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := b.GetRoot(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := b.CompareAndSetRoot(ctx, base, testHash(2)); err != nil || !ok {
+				t.Fatalf("first writer: got %v, %v", ok, err)
+			}
+			if ok, err := a.CompareAndSetRoot(ctx, base, testHash(3)); err != nil || ok {
+				t.Fatalf("second writer: got %v, %v, want a mismatch", ok, err)
+			}
+			checkRoot(t, a, testHash(2))
+			checkRoot(t, NewMerkleRedisStorage(srv.Client(t), "cas_"+tc.name, tc.opts...), testHash(2))
+
+			if ok, err := a.CompareAndSetRoot(ctx, testHash(2), testHash(3)); err != nil || !ok {
+				t.Fatalf("retry: got %v, %v", ok, err)
+			}
+			checkRoot(t, a, testHash(3))
+			if _, ts, err := a.GetRootWithTimestamp(ctx); err != nil || ts.IsZero() {
+				t.Fatalf("timestamp: got %v, %v", ts, err)
+			}
+		})
+	}
+}
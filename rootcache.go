@@ -0,0 +1,114 @@
+package merkleredis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// RootInvalidation selects how a store notices root changes made by other
+// processes, see WithRootInvalidation.
+type RootInvalidation struct {
+	keyspace bool
+	maxAge   time.Duration
+}
+
+// KeyspaceNotifications clears the cached root whenever the root key changes,
+// using Redis keyspace notifications. The server must publish them for string
+// and generic commands, for example with notify-keyspace-events set to "Kg$".
+// Changes made while the subscription is reconnecting are missed, and with
+// Redis Cluster the notifications are only published by the node holding the
+// root key, which the subscription may not be connected to; prefer RootCacheTTL
+// there.
+func KeyspaceNotifications() RootInvalidation {
+	return RootInvalidation{keyspace: true}
+}
+
+// RootCacheTTL reloads the root from Redis once the cached value is older than
+// d, bounding how stale it can be.
+func RootCacheTTL(d time.Duration) RootInvalidation {
+	return RootInvalidation{maxAge: d}
+}
+
+// watchRoot subscribes to keyspace notifications of the root key and clears
+// the cached root on each of them, until Close.
+func (s *Storage) watchRoot() {
+	db := 0
+	if c, ok := s.db.(*redis.Client); ok {
+		db = c.Options().DB
+	}
+	s.rootSub = s.db.Subscribe(context.Background(), fmt.Sprintf("__keyspace@%d__:%s", db, s.rootId))
+	ch := s.rootSub.Channel()
+	go func() {
+		for range ch {
+			s.invalidateRoot()
+		}
+	}()
+}
+
+// invalidateRoot clears the cached root, so that the next GetRoot reads it from
+// Redis.
+func (s *Storage) invalidateRoot() {
+	s.rootMu.Lock()
+	defer s.rootMu.Unlock()
+	s.currentRoot = nil
+	s.rootGen++
+}
+
+// cachedRoot returns the cached root if it is still fresh. The caller must hold
+// rootMu.
+func (s *Storage) cachedRoot() *merkletree.Hash {
+	if s.currentRoot == nil {
+		return nil
+	}
+	if s.rootInvalidation.maxAge > 0 && time.Since(s.rootLoadedAt) >= s.rootInvalidation.maxAge {
+		return nil
+	}
+	return s.currentRoot
+}
+
+// cacheRoot replaces the cached root with a copy of hash, unless WithRootCache
+// disabled it. The copy is newly allocated rather than written over the
+// previous root, which is never modified once cached, so code still holding
+// it sees a whole hash. The caller must hold rootMu for writing.
+func (s *Storage) cacheRoot(hash *merkletree.Hash) {
+	if s.noRootCache {
+		return
+	}
+	root := *hash
+	s.currentRoot = &root
+	s.rootLoadedAt = time.Now()
+}
+
+// VerifyRootCache reads the root from Redis and reports whether the cached
+// root, if any, matches it, to catch invalidation bugs in production. A store
+// without a cached root has nothing to diverge and reports true; a cached root
+// while Redis has none reports false. Writes through this store wait for the
+// check, so a concurrent SetRoot can't cause a false mismatch, but a root
+// changed by another process without invalidation is reported as one, which is
+// what the check is for.
+func (s *Storage) VerifyRootCache(ctx context.Context) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	s.rootMu.RLock()
+	defer s.rootMu.RUnlock()
+	cached := s.cachedRoot()
+	if cached == nil {
+		return true, nil
+	}
+	v, err := s.db.Get(ctx, s.rootId).Result()
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, newErr(err, "failed to read root")
+	}
+	var root merkletree.Hash
+	if err := s.decodeRoot(s.rootId, v, &root); err != nil {
+		return false, err
+	}
+	return root == *cached, nil
+}
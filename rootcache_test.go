@@ -0,0 +1,217 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestRootInvalidationKeyspaceNotifications(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	srv.EnableKeyspaceNotifications()
+	writer := NewMerkleRedisStorage(srv.Client(t), "watch")
+	s := NewMerkleRedisStorage(srv.Client(t), "watch", WithRootInvalidation(KeyspaceNotifications()))
+	defer s.Close()
+
+	channel := "__keyspace@0__:" + s.rootId
+	waitFor(t, func() bool { return srv.Subscribers(channel) == 1 })
+
+	if err := writer.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	checkRoot(t, s, testHash(1))
+	if err := writer.SetRoot(ctx, testHash(2)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		root, err := s.GetRoot(ctx)
+		return err == nil && *root == *testHash(2)
+	})
+
+	s.Close()
+	waitFor(t, func() bool { return srv.Subscribers(channel) == 0 })
+}
+
+func TestRootInvalidationTTL(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	writer := NewMerkleRedisStorage(srv.Client(t), "ttl")
+	s := NewMerkleRedisStorage(srv.Client(t), "ttl", WithRootInvalidation(RootCacheTTL(50*time.Millisecond)))
+
+	if err := writer.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	checkRoot(t, s, testHash(1))
+	if err := writer.SetRoot(ctx, testHash(2)); err != nil {
+		t.Fatal(err)
+	}
+	// still within the staleness window
+	checkRoot(t, s, testHash(1))
+	time.Sleep(60 * time.Millisecond)
+	checkRoot(t, s, testHash(2))
+}
+
+func checkRoot(t *testing.T, s *Storage, want *merkletree.Hash) {
+	t.Helper()
+	root, err := s.GetRoot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *root != *want {
+		t.Fatalf("root: got %x, want %x", root[:], want[:])
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestVerifyRootCache(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "verify")
+
+	if ok, err := s.VerifyRootCache(ctx); err != nil || !ok {
+		t.Fatalf("no cached root: got %v, %v", ok, err)
+	}
+	if err := s.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.VerifyRootCache(ctx); err != nil || !ok {
+		t.Fatalf("after SetRoot: got %v, %v", ok, err)
+	}
+
+	// a cache diverging from Redis, as an invalidation bug would leave it
+	s.rootMu.Lock()
+	s.currentRoot = testHash(9)
+	s.rootMu.Unlock()
+	if ok, err := s.VerifyRootCache(ctx); err != nil || ok {
+		t.Fatalf("corrupted cache: got %v, %v", ok, err)
+	}
+	checkRoot(t, s, testHash(9))
+
+	// a root changed behind the store's back
+	s.rootMu.Lock()
+	s.currentRoot = testHash(1)
+	s.rootMu.Unlock()
+	if err := NewMerkleRedisStorage(srv.Client(t), "verify").SetRoot(ctx, testHash(2)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.VerifyRootCache(ctx); err != nil || ok {
+		t.Fatalf("stale cache: got %v, %v", ok, err)
+	}
+	srv.Delete(s.rootId)
+	if ok, err := s.VerifyRootCache(ctx); err != nil || ok {
+		t.Fatalf("cached root without a stored one: got %v, %v", ok, err)
+	}
+
+	srv.SetRaw(s.rootId, []byte("short"))
+	if _, err := s.VerifyRootCache(ctx); !errors.Is(err, ErrCorruptRoot) {
+		t.Fatalf("corrupt stored root: got %v, want ErrCorruptRoot", err)
+	}
+}
+
+func TestRootCacheDisabled(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	writer := NewMerkleRedisStorage(srv.Client(t), "nocache")
+	s := NewMerkleRedisStorage(srv.Client(t), "nocache", WithRootCache(false))
+
+	if err := s.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := srv.Raw(s.rootId); !ok || string(v) != string(testHash(1)[:]) {
+		t.Fatalf("SetRoot didn't write through: %x", v)
+	}
+	gets := srv.Count("GET")
+	for i := 0; i < 3; i++ {
+		checkRoot(t, s, testHash(1))
+	}
+	if got := srv.Count("GET") - gets; got != 3 {
+		t.Fatalf("3 GetRoot calls sent %d GETs, want 3", got)
+	}
+
+	// another process's root is seen at once, without invalidation
+	if err := writer.SetRoot(ctx, testHash(2)); err != nil {
+		t.Fatal(err)
+	}
+	checkRoot(t, s, testHash(2))
+
+	// a caching store reads the root once
+	cached := NewMerkleRedisStorage(srv.Client(t), "nocache")
+	gets = srv.Count("GET")
+	for i := 0; i < 3; i++ {
+		checkRoot(t, cached, testHash(2))
+	}
+	if got := srv.Count("GET") - gets; got != 1 {
+		t.Fatalf("3 cached GetRoot calls sent %d GETs, want 1", got)
+	}
+}
+
+func TestRootCacheConcurrentSetRoot(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStorage(t, "rootrace")
+	if err := s.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	s.rootMu.RLock()
+	held := s.currentRoot
+	s.rootMu.RUnlock()
+
+	// readers must only ever see one of the whole hashes written, each of a
+	// single repeated byte; run with -race to catch unguarded accesses
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	errs := make(chan error, 4)
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				root, err := s.GetRoot(ctx)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if *root != *testHash(root[0]) {
+					errs <- fmt.Errorf("torn root %x", root[:])
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		if err := s.SetRoot(ctx, testHash(byte(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if *held != *testHash(1) {
+		t.Fatalf("SetRoot modified the previously cached root: %x", held[:])
+	}
+}
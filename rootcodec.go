@@ -0,0 +1,23 @@
+package merkleredis
+
+import "github.com/iden3/go-merkletree-sql/v2"
+
+// RootCodec serializes the root value stored by SetRoot and read back by
+// GetRoot, for example to store a version or a signature alongside the hash.
+// Decode must accept every value Encode returns, and Encode must be
+// deterministic for CompareAndSetRoot, which compares encoded values.
+type RootCodec interface {
+	Encode(*merkletree.Hash) ([]byte, error)
+	Decode([]byte) (*merkletree.Hash, error)
+}
+
+// WithRootCodec serializes roots, including those recorded in the root history,
+// with c instead of storing the 32 hash bytes, to which WithHexEncoding still
+// applies. Roots stored without c, or with another RootCodec, must be rewritten
+// before the store can read them. The cached root is the decoded hash, so
+// cached reads don't call Decode.
+func WithRootCodec(c RootCodec) Option {
+	return func(s *Storage) {
+		s.rootCodec = c
+	}
+}
@@ -0,0 +1,83 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// versionedRootCodec stores the root hash followed by a version byte.
+type versionedRootCodec struct {
+	version byte
+}
+
+func (c versionedRootCodec) Encode(h *merkletree.Hash) ([]byte, error) {
+	return append(append([]byte(nil), h[:]...), c.version), nil
+}
+
+func (c versionedRootCodec) Decode(d []byte) (*merkletree.Hash, error) {
+	var h merkletree.Hash
+	if len(d) != len(h)+1 {
+		return nil, fmt.Errorf("got %d bytes, want %d", len(d), len(h)+1)
+	}
+	if d[len(h)] != c.version {
+		return nil, fmt.Errorf("root version %d, want %d", d[len(h)], c.version)
+	}
+	copy(h[:], d)
+	return &h, nil
+}
+
+func TestRootCodec(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	codec := WithRootCodec(versionedRootCodec{version: 7})
+	s := NewMerkleRedisStorage(srv.Client(t), "codec", codec, WithRootHistory(2))
+
+	if err := s.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := srv.Raw(s.rootId)
+	if want := append(testHash(1)[:], 7); !bytes.Equal(raw, want) {
+		t.Fatalf("stored root: got %x, want %x", raw, want)
+	}
+
+	fresh := NewMerkleRedisStorage(srv.Client(t), "codec", codec)
+	checkRoot(t, fresh, testHash(1))
+	gets := srv.Count("GET")
+	checkRoot(t, fresh, testHash(1))
+	if n := srv.Count("GET") - gets; n != 0 {
+		t.Fatalf("cached GetRoot sent %d GET commands", n)
+	}
+
+	if ok, err := s.CompareAndSetRoot(ctx, testHash(1), testHash(2)); err != nil || !ok {
+		t.Fatalf("CompareAndSetRoot: got %v, %v", ok, err)
+	}
+	checkRoot(t, NewMerkleRedisStorage(srv.Client(t), "codec", codec), testHash(2))
+	hist, err := s.GetRootHistory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != 2 || *hist[0] != *testHash(2) || *hist[1] != *testHash(1) {
+		t.Fatalf("history: got %v", hist)
+	}
+
+	hexStore := NewMerkleRedisStorage(srv.Client(t), "codechex", codec, WithHexEncoding())
+	if err := hexStore.SetRoot(ctx, testHash(3)); err != nil {
+		t.Fatal(err)
+	}
+	checkRoot(t, NewMerkleRedisStorage(srv.Client(t), "codechex", codec, WithHexEncoding()), testHash(3))
+
+	for _, other := range []*Storage{
+		NewMerkleRedisStorage(srv.Client(t), "codec"),
+		NewMerkleRedisStorage(srv.Client(t), "codec", WithRootCodec(versionedRootCodec{version: 8})),
+	} {
+		if root, err := other.GetRoot(ctx); !errors.Is(err, ErrCorruptRoot) {
+			t.Fatalf("GetRoot with another codec: got %v, %v, want ErrCorruptRoot", root, err)
+		}
+	}
+}
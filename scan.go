@@ -0,0 +1,305 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// defaultScanBatch is the COUNT hint passed to SCAN unless WithScanBatch
+// sets another.
+const defaultScanBatch = 1000
+
+// WithScanBatch sets the COUNT hint passed to SCAN by the methods that
+// enumerate the keys of the tree, such as List, Reset and Clear, to count
+// instead of defaultScanBatch. Larger values mean fewer round trips on large
+// trees but longer individual SCAN calls; Redis may return more or fewer keys
+// than the hint. count <= 0 keeps the default.
+func WithScanBatch(count int) Option {
+	return func(s *Storage) {
+		s.scanBatch = count
+	}
+}
+
+// scanCount returns the COUNT hint to pass to SCAN.
+func (s *Storage) scanCount() int64 {
+	if s.scanBatch > 0 {
+		return int64(s.scanBatch)
+	}
+	return defaultScanBatch
+}
+
+// List returns up to limit nodes of the tree, or all of them if limit is not
+// positive. Keys are enumerated with SCAN so Redis is not blocked on large
+// trees; the order of the result is unspecified. Nodes that can't be decoded
+// are skipped with a warning to the logger set with WithLogger. Use ForEach to
+// process large trees without holding every node in memory.
+func (s *Storage) List(ctx context.Context, limit int) ([]KV, error) {
+	var kvs []KV
+	err := s.ForEach(ctx, func(kv KV) error {
+		kvs = append(kvs, kv)
+		if limit > 0 && len(kvs) == limit {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return kvs, nil
+}
+
+// ListByType is like List but returns only nodes of type t, for example the
+// leaves to enumerate the entries of the tree. Every node is still read, but
+// those of other types are skipped by their type byte before being converted,
+// and don't count towards limit.
+func (s *Storage) ListByType(ctx context.Context, t merkletree.NodeType, limit int) ([]KV, error) {
+	var kvs []KV
+	err := s.scanNodes(ctx, func(item *NodeItem) error {
+		if merkletree.NodeType(item.Type) != t {
+			return nil
+		}
+		node, err := item.Node()
+		if err != nil {
+			s.warnf("skipping invalid node %x: %v", item.Key, err)
+			return nil
+		}
+		kvs = append(kvs, KV{K: item.Key, V: *node})
+		if limit > 0 && len(kvs) == limit {
+			return errStopScan
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return kvs, nil
+}
+
+// ErrStopIteration is returned by a ForEach callback to end the iteration
+// early without an error.
+var ErrStopIteration = errors.New("stop iteration")
+
+// ForEach calls fn with every node of the tree, enumerating them with SCAN one
+// page at a time, so memory use doesn't grow with the tree. The order is
+// unspecified. If fn returns ErrStopIteration the iteration ends and ForEach
+// returns nil; any other error ends it and is returned. Nodes that can't be
+// decoded are skipped with a warning, as with List.
+func (s *Storage) ForEach(ctx context.Context, fn func(kv KV) error) error {
+	return s.scanNodes(ctx, func(item *NodeItem) error {
+		node, err := item.Node()
+		if err != nil {
+			s.warnf("skipping invalid node %x: %v", item.Key, err)
+			return nil
+		}
+		if err := fn(KV{K: item.Key, V: *node}); err == ErrStopIteration {
+			return errStopScan
+		} else if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// errStopScan ends scanNodes early without an error.
+var errStopScan = errors.New("stop scan")
+
+// scanNodes calls fn with every node of the tree, enumerating keys with SCAN
+// and reading each page of keys in one pipeline. Returning errStopScan from fn
+// ends the scan with a nil error. The operation timeout applies to each page.
+// Values that can't be decoded are skipped with a warning.
+func (s *Storage) scanNodes(ctx context.Context, fn func(item *NodeItem) error) error {
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		items, next, err := s.scanNodePage(ctx, cursor)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := fn(item); err == errStopScan {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// scanNodePage reads the nodes of one SCAN page starting at cursor.
+func (s *Storage) scanNodePage(ctx context.Context, cursor uint64) ([]*NodeItem, uint64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	keys, next, err := s.db.Scan(ctx, cursor, globEscape(s.nodeIdPrefix)+"*", s.scanCount()).Result()
+	if err != nil {
+		return nil, 0, newErr(err, "failed to scan nodes")
+	}
+	if keys = s.ownNodeKeys(s.nodeIdPrefix, keys); len(keys) == 0 {
+		return nil, next, nil
+	}
+	pipe := s.db.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, k := range keys {
+		cmds[i] = pipe.Get(ctx, k)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, 0, newErr(err, "failed to read nodes")
+	}
+	items := make([]*NodeItem, 0, len(keys))
+	for i, cmd := range cmds {
+		if cmd.Err() == redis.Nil {
+			// removed since it was scanned
+			continue
+		}
+		item, err := s.decodeNodeItem(cmd.Val())
+		if err != nil {
+			s.warnf("skipping corrupt node %s: %v", keys[i], err)
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, next, nil
+}
+
+// scanKeys calls fn with each page of keys matching pattern.
+func (s *Storage) scanKeys(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		keys, next, err := s.scanKeyPage(ctx, cursor, pattern)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+func (s *Storage) scanKeyPage(ctx context.Context, cursor uint64, pattern string) ([]string, uint64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	keys, next, err := s.db.Scan(ctx, cursor, pattern, s.scanCount()).Result()
+	if err != nil {
+		return nil, 0, newErr(err, "failed to scan keys")
+	}
+	return keys, next, nil
+}
+
+// scanNodeKeys calls fn with each page of the node keys of the tree, see
+// scanTreeNodeKeys.
+func (s *Storage) scanNodeKeys(ctx context.Context, fn func(keys []string) error) error {
+	return s.scanTreeNodeKeys(ctx, s.nodeIdPrefix, fn)
+}
+
+// scanTreeNodeKeys calls fn with each page of the node keys starting with
+// nodeIdPrefix, skipping those of derived trees, see ownNodeKeys.
+func (s *Storage) scanTreeNodeKeys(ctx context.Context, nodeIdPrefix string, fn func(keys []string) error) error {
+	return s.scanKeys(ctx, globEscape(nodeIdPrefix)+"*", func(keys []string) error {
+		if keys = s.ownNodeKeys(nodeIdPrefix, keys); len(keys) == 0 {
+			return nil
+		}
+		return fn(keys)
+	})
+}
+
+// ownNodeKeys filters keys, matched by the SCAN pattern for nodeIdPrefix, down
+// to the node keys of that tree, reusing their backing array. The pattern also
+// matches the node keys of trees whose prefix extends the tree's after the
+// separator, such as those created by WithPrefix. Unless a key encoder is set,
+// these are told apart by the separator in what follows the node key prefix,
+// which a hex-encoded key never holds.
+func (s *Storage) ownNodeKeys(nodeIdPrefix string, keys []string) []string {
+	if s.keyEncoder != nil {
+		return keys
+	}
+	owned := keys[:0]
+	for _, k := range keys {
+		if !strings.Contains(k[len(nodeIdPrefix):], s.sep()) {
+			owned = append(owned, k)
+		}
+	}
+	return owned
+}
+
+// deleteKeys removes keys with one pipelined DEL per key, so that keys in
+// different cluster slots can be removed together.
+func (s *Storage) deleteKeys(ctx context.Context, keys []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	pipe := s.db.Pipeline()
+	for _, k := range keys {
+		pipe.Del(ctx, k)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return newErr(err, "failed to delete keys")
+	}
+	return nil
+}
+
+// Reset deletes every node and the root of the tree. Node keys are found with
+// SCAN and removed in pipelined batches, so Redis isn't blocked on large trees,
+// but nodes written concurrently with Reset may survive it.
+func (s *Storage) Reset(ctx context.Context) error {
+	err := s.scanNodeKeys(ctx, func(keys []string) error {
+		return s.deleteKeys(ctx, keys)
+	})
+	s.nodeCache.purge()
+	if err != nil {
+		return err
+	}
+
+	s.rootMu.Lock()
+	defer s.rootMu.Unlock()
+	if err := s.deleteKeys(ctx, []string{s.rootId, s.rootId + nodeCountSuffix, s.rootId + rootTimestampSuffix}); err != nil {
+		return err
+	}
+	s.currentRoot = nil
+	return s.recordRootWrite(ctx, nil)
+}
+
+// Clear removes every key of the tree: its nodes, root, root timestamp, root
+// history, labeled roots, node counter, format version and tree version,
+// leaving the rest of the database alone. Use it rather than FLUSHDB to
+// discard a tree on a shared database. Like Reset it works with SCAN and
+// pipelined DEL, so nodes written concurrently may survive it. A lock held
+// with Lock is not released.
+func (s *Storage) Clear(ctx context.Context) error {
+	if err := s.Reset(ctx); err != nil {
+		return err
+	}
+	err := s.scanKeys(ctx, globEscape(s.labeledRootId(""))+"*", func(keys []string) error {
+		return s.deleteKeys(ctx, keys)
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.deleteKeys(ctx, []string{s.rootId + rootHistorySuffix, s.rootId + formatSuffix, s.rootId + versionSuffix}); err != nil {
+		return err
+	}
+	s.formatRecorded.Store(false)
+	return nil
+}
@@ -0,0 +1,286 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "list", WithScanBatch(100))
+	other := NewMerkleRedisStorage(srv.Client(t), "other")
+
+	// more than one SCAN page
+	kvs := testLeafKVs(250)
+	if err := s.PutBatch(ctx, kvs); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.PutBatch(ctx, testLeafKVs(10)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.List(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(kvs) {
+		t.Fatalf("got %d nodes, want %d", len(got), len(kvs))
+	}
+	want := map[string]KV{}
+	for _, kv := range kvs {
+		want[string(kv.K)] = kv
+	}
+	for _, kv := range got {
+		w, ok := want[string(kv.K)]
+		if !ok {
+			t.Fatalf("unexpected key %x", kv.K)
+		}
+		if kv.V.Type != w.V.Type || !bytes.Equal(kv.V.Entry[1][:], w.V.Entry[1][:]) {
+			t.Fatalf("key %x: got %+v, want %+v", kv.K, kv.V, w.V)
+		}
+		delete(want, string(kv.K))
+	}
+
+	got, err = s.List(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 7 {
+		t.Fatalf("got %d nodes with limit 7", len(got))
+	}
+}
+
+func TestForEach(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "foreach", WithScanBatch(100))
+	kvs := testLeafKVs(250)
+	if err := s.PutBatch(ctx, kvs); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	err := s.ForEach(ctx, func(kv KV) error {
+		seen[string(kv.K)] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(kvs) {
+		t.Fatalf("visited %d nodes, want %d", len(seen), len(kvs))
+	}
+
+	// stopping in the second page
+	calls := 0
+	err = s.ForEach(ctx, func(kv KV) error {
+		calls++
+		if calls == 130 {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil || calls != 130 {
+		t.Fatalf("stopped ForEach: got %d calls, %v; want 130, nil", calls, err)
+	}
+
+	errBoom := errors.New("boom")
+	calls = 0
+	err = s.ForEach(ctx, func(kv KV) error {
+		calls++
+		if calls == 5 {
+			return errBoom
+		}
+		return nil
+	})
+	if err != errBoom || calls != 5 {
+		t.Fatalf("failed ForEach: got %d calls, %v; want 5, %v", calls, err, errBoom)
+	}
+}
+
+func TestListByType(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStorage(t, "bytype")
+	newTestTree(t, s, 8)
+
+	all, err := s.List(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[merkletree.NodeType]int{}
+	for _, kv := range all {
+		counts[kv.V.Type]++
+	}
+	if counts[merkletree.NodeTypeLeaf] == 0 || counts[merkletree.NodeTypeMiddle] == 0 {
+		t.Fatalf("tree isn't mixed: %v", counts)
+	}
+
+	leaves, err := s.ListByType(ctx, merkletree.NodeTypeLeaf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaves) != counts[merkletree.NodeTypeLeaf] {
+		t.Fatalf("got %d leaves, want %d", len(leaves), counts[merkletree.NodeTypeLeaf])
+	}
+	entries := map[int64]bool{}
+	for _, kv := range leaves {
+		if kv.V.Type != merkletree.NodeTypeLeaf {
+			t.Fatalf("got a node of type %d", kv.V.Type)
+		}
+		entries[kv.V.Entry[0].BigInt().Int64()] = true
+	}
+	for i := int64(0); i < 8; i++ {
+		if !entries[i] {
+			t.Fatalf("leaf of key %d missing", i)
+		}
+	}
+
+	if got, err := s.ListByType(ctx, merkletree.NodeTypeLeaf, 3); err != nil || len(got) != 3 {
+		t.Fatalf("limit 3: got %d leaves, %v", len(got), err)
+	}
+	middles, err := s.ListByType(ctx, merkletree.NodeTypeMiddle, 0)
+	if err != nil || len(middles) != counts[merkletree.NodeTypeMiddle] {
+		t.Fatalf("got %d middle nodes, %v, want %d", len(middles), err, counts[merkletree.NodeTypeMiddle])
+	}
+}
+
+func TestScansSkipDerivedTrees(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "scans")
+	child := s.WithPrefix("child")
+	kvs := testLeafKVs(5)
+	if err := s.PutBatch(ctx, kvs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := child.PutBatch(ctx, kvs[2:]); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := s.List(ctx, 0); err != nil || len(got) != 2 {
+		t.Fatalf("List: got %d nodes, %v, want 2", len(got), err)
+	}
+	if got, err := s.ListByType(ctx, merkletree.NodeTypeLeaf, 0); err != nil || len(got) != 2 {
+		t.Fatalf("ListByType: got %d nodes, %v, want 2", len(got), err)
+	}
+	var n int
+	if err := s.ForEach(ctx, func(KV) error { n++; return nil }); err != nil || n != 2 {
+		t.Fatalf("ForEach: visited %d nodes, %v, want 2", n, err)
+	}
+
+	clone, err := s.Clone(ctx, "scans_clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(nodeKeys(srv, clone)); n != 2 {
+		t.Fatalf("Clone copied %d nodes, want 2", n)
+	}
+
+	// promoting the parent of a derived tree leaves the derived tree in place
+	live := NewMerkleRedisStorageUniversal(s.db, "scans_live")
+	if err := s.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := live.Promote(ctx, "scans"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(nodeKeys(srv, live)); n != 2 {
+		t.Fatalf("Promote moved %d nodes, want 2", n)
+	}
+	if got, err := child.List(ctx, 0); err != nil || len(got) != 3 {
+		t.Fatalf("derived tree after Promote: got %d nodes, %v, want 3", len(got), err)
+	}
+}
+
+func TestListCanceled(t *testing.T) {
+	s, _ := newTestStorage(t, "list")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.List(ctx, 0); err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "reset")
+	other := NewMerkleRedisStorage(srv.Client(t), "other")
+
+	kvs := testLeafKVs(250)
+	if err := s.PutBatch(ctx, kvs); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.PutBatch(ctx, testLeafKVs(5)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetRoot(ctx); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("GetRoot: got %v, want ErrNotFound", err)
+	}
+	for _, kv := range kvs {
+		if _, err := s.Get(ctx, kv.K); !errors.Is(err, merkletree.ErrNotFound) {
+			t.Fatalf("Get %x: got %v, want ErrNotFound", kv.K, err)
+		}
+	}
+	if got, err := other.List(ctx, 0); err != nil || len(got) != 5 {
+		t.Fatalf("other tree: got %d nodes, %v", len(got), err)
+	}
+}
+
+func TestClear(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "clear", WithRootHistory(3), WithNodeCounter())
+	// a derived tree's keys share the scanned key prefix, a sibling's don't
+	child := s.WithPrefix("child")
+	sibling := NewMerkleRedisStorage(srv.Client(t), "clearing")
+	srv.SetRaw("unrelated", []byte("keep"))
+
+	for _, st := range []*Storage{s, child, sibling} {
+		newTestTree(t, st, 5)
+	}
+	if _, err := s.NodeCount(ctx); err != nil {
+		t.Fatal(err)
+	}
+	survivors := map[string]bool{"unrelated": true}
+	for _, k := range srv.Keys() {
+		if strings.Contains(k, "clear_child") || strings.Contains(k, "clearing") {
+			survivors[k] = true
+		}
+	}
+
+	if err := s.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	keys := srv.Keys()
+	for _, k := range keys {
+		if !survivors[k] {
+			t.Fatalf("key %q survived Clear", k)
+		}
+	}
+	if len(keys) != len(survivors) {
+		t.Fatalf("got %d keys after Clear, want %d", len(keys), len(survivors))
+	}
+	if _, err := s.GetRoot(ctx); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatalf("GetRoot: got %v, want ErrNotFound", err)
+	}
+	for _, st := range []*Storage{child, sibling} {
+		fresh := NewMerkleRedisStorageUniversal(st.db, st.prefix)
+		if problems, err := fresh.VerifyIntegrity(ctx); err != nil || len(problems) != 0 {
+			t.Fatalf("tree %q after Clear: got %v, %v", st.prefix, problems, err)
+		}
+	}
+}
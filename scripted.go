@@ -0,0 +1,73 @@
+package merkleredis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// getNodeScript returns the value of the node in KEYS[1].
+var getNodeScript = redis.NewScript(`return redis.call('GET', KEYS[1])`)
+
+// putNodeScript sets the node in KEYS[1] to ARGV[1], expiring after ARGV[2]
+// milliseconds if positive, and increments the node counter in KEYS[2], if
+// given, when the node is new.
+var putNodeScript = redis.NewScript(`
+local new = redis.call('EXISTS', KEYS[1]) == 0
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ttl)
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+if KEYS[2] and new then
+	redis.call('INCR', KEYS[2])
+end
+return 1
+`)
+
+// evalScripted runs script on client with EVALSHA, loading it with SCRIPT LOAD
+// first if the server doesn't have it, so that only those two commands are
+// used. redis.Script.Run would fall back to EVAL instead.
+func evalScripted(ctx context.Context, client redis.Scripter, script *redis.Script, keys []string, args ...interface{}) *redis.Cmd {
+	cmd := script.EvalSha(ctx, client, keys, args...)
+	if err := cmd.Err(); err == nil || !strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		return cmd
+	}
+	if err := script.Load(ctx, client).Err(); err != nil {
+		cmd.SetErr(err)
+		return cmd
+	}
+	return script.EvalSha(ctx, client, keys, args...)
+}
+
+// getValue reads the value of the node key id, with a script under
+// WithScriptedAccess, refreshing its expiry under WithSlidingTTL.
+func (s *Storage) getValue(ctx context.Context, id string) (string, error) {
+	if s.scriptedAccess {
+		return evalScripted(ctx, s.reader(), getNodeScript, []string{id}).Text()
+	}
+	if s.slidingTTL && s.ttl > 0 {
+		// GETEX writes the expiry, so it goes to the primary even with a
+		// read client
+		return s.db.GetEx(ctx, id, s.ttl).Result()
+	}
+	return s.reader().Get(ctx, id).Result()
+}
+
+// putValue writes v to the node key id, with a script under
+// WithScriptedAccess, updating the node counter if it is maintained.
+func (s *Storage) putValue(ctx context.Context, id string, v interface{}) error {
+	if s.scriptedAccess {
+		keys := []string{id}
+		if s.nodeCounter {
+			keys = append(keys, s.rootId+nodeCountSuffix)
+		}
+		return evalScripted(ctx, s.db, putNodeScript, keys, v, s.ttl.Milliseconds()).Err()
+	}
+	if s.nodeCounter {
+		return s.putCounted(ctx, id, v)
+	}
+	return s.db.Set(ctx, id, v, s.ttl).Err()
+}
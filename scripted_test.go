@@ -0,0 +1,95 @@
+package merkleredis
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+)
+
+func init() {
+	fakeredis.RegisterScript(getNodeScript.Hash(), func(c *fakeredis.Conn, keys, argv [][]byte) {
+		if v := c.Srv.Lookup(string(keys[0])); v != nil && !v.IsList {
+			c.WriteBulk(v.Str)
+		} else {
+			c.WriteNil()
+		}
+	})
+	fakeredis.RegisterScript(putNodeScript.Hash(), func(c *fakeredis.Conn, keys, argv [][]byte) {
+		isNew := c.Srv.Lookup(string(keys[0])) == nil
+		ttl, _ := strconv.ParseInt(string(argv[1]), 10, 64)
+		c.Srv.SetString(string(keys[0]), argv[0], time.Duration(ttl)*time.Millisecond)
+		if len(keys) > 1 && isNew {
+			var n int64
+			if v := c.Srv.Lookup(string(keys[1])); v != nil {
+				n, _ = strconv.ParseInt(string(v.Str), 10, 64)
+			}
+			c.Srv.SetString(string(keys[1]), []byte(strconv.FormatInt(n+1, 10)), 0)
+		}
+		c.WriteInt(1)
+	})
+}
+
+func TestScriptedAccess(t *testing.T) {
+	ctx := context.Background()
+	direct := fakeredis.New(t)
+	scripted := fakeredis.New(t)
+	opts := []Option{WithNodeCounter(), WithTTL(time.Hour)}
+	a := NewMerkleRedisStorage(direct.Client(t), "scripted", opts...)
+	b := NewMerkleRedisStorage(scripted.Client(t), "scripted", append(opts, WithScriptedAccess(true))...)
+
+	mtA, mtB := newTestTree(t, a, 10), newTestTree(t, b, 10)
+	if *mtA.Root() != *mtB.Root() {
+		t.Fatalf("roots differ: %v and %v", mtA.Root(), mtB.Root())
+	}
+	keysA, keysB := direct.Keys(), scripted.Keys()
+	sort.Strings(keysA)
+	sort.Strings(keysB)
+	if len(keysA) != len(keysB) {
+		t.Fatalf("got %d keys in scripted mode, want %d", len(keysB), len(keysA))
+	}
+	for i, k := range keysA {
+		va, _ := direct.Raw(k)
+		vb, _ := scripted.Raw(keysB[i])
+		if k == a.rootId+rootTimestampSuffix {
+			continue
+		}
+		if keysB[i] != k || !bytes.Equal(va, vb) {
+			t.Fatalf("key %q: scripted mode stored %q = %x, want %x", k, keysB[i], vb, va)
+		}
+	}
+	if scripted.Count("EVALSHA") == 0 || scripted.Count("EVAL") != 0 {
+		t.Fatalf("got %d EVALSHA and %d EVAL calls", scripted.Count("EVALSHA"), scripted.Count("EVAL"))
+	}
+
+	// reading every node through a fresh store issues no GET
+	gets := scripted.Count("GET")
+	fresh := NewMerkleRedisStorage(scripted.Client(t), "scripted", WithScriptedAccess(true))
+	kvs, err := a.List(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range kvs {
+		got, err := fresh.Get(ctx, kv.K)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotKey, err := got.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gotKey[:], kv.K) {
+			t.Fatalf("node %x: got a node with key %x", kv.K, gotKey[:])
+		}
+	}
+	if n := scripted.Count("GET"); n != gets {
+		t.Fatalf("scripted Get issued %d GET commands", n-gets)
+	}
+	if n, err := b.NodeCount(ctx); err != nil || n != int64(len(kvs)) {
+		t.Fatalf("node count: got %d, %v, want %d", n, err, len(kvs))
+	}
+}
@@ -0,0 +1,171 @@
+package merkleredis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// pathLibrary is the name of the Redis Function library of the store, and
+// pathFunction that of its function walking a path, see ServerSidePathNodes.
+const (
+	pathLibrary  = "merkleredis"
+	pathFunction = "merkleredis_path"
+)
+
+// pathLibraryCode defines pathFunction. Called with the root key in KEYS[1]
+// and the node key prefix, the leaf key, "1" for hex encoded values and the
+// maximum number of levels in ARGV, it returns the root value followed by the
+// values of the nodes on the path down to the leaf, as stored, or an empty
+// array if there is no root. The walk stops at a leaf, an empty node or
+// subtree, a missing node or a value it can't parse, which the caller tells
+// apart by decoding the values itself.
+const pathLibraryCode = `#!lua name=` + pathLibrary + `
+local zero = string.rep('\0', 32)
+
+local function u32(s, i)
+	local a, b, c, d = string.byte(s, i, i + 3)
+	return a + b * 256 + c * 65536 + d * 16777216
+end
+
+local function uvarint(s, i)
+	local n, scale = 0, 1
+	while true do
+		local b = string.byte(s, i)
+		if not b then return nil, i end
+		i = i + 1
+		n = n + (b % 128) * scale
+		if b < 128 then return n, i end
+		scale = scale * 128
+	end
+end
+
+-- children returns the type and children of the serialized node d, or nil
+local function children(d)
+	local first = string.byte(d, 1)
+	if not first then return nil end
+	if first == 0x83 then
+		local t, i, lens = string.byte(d, 2), 3, {}
+		for k = 1, 5 do
+			lens[k], i = uvarint(d, i)
+			if not lens[k] then return nil end
+		end
+		local p = i + lens[1]
+		return t, string.sub(d, p, p + lens[2] - 1), string.sub(d, p + lens[2], p + lens[2] + lens[3] - 1)
+	end
+	if first == 0x81 or first == 0x82 then
+		d = string.sub(d, 2)
+	elseif first >= 0x80 then
+		return nil
+	end
+	if #d < 17 then return nil end
+	local p = 18 + u32(d, 2)
+	local l = u32(d, 6)
+	return string.byte(d, 1), string.sub(d, p, p + l - 1), string.sub(d, p + l, p + l + u32(d, 10) - 1)
+end
+
+local function path(keys, args)
+	local prefix, leaf, hex, levels = args[1], args[2], args[3] == '1', tonumber(args[4])
+	local decode = function(v)
+		if hex then
+			return (v:gsub('..', function(cc) return string.char(tonumber(cc, 16)) end))
+		end
+		return v
+	end
+	local root = redis.call('GET', keys[1])
+	if not root then return {} end
+	local out = {root}
+	local key = decode(root)
+	for level = 0, levels - 1 do
+		if key == zero then break end
+		local v = redis.call('GET', prefix .. (key:gsub('.', function(c) return string.format('%02x', string.byte(c)) end)))
+		if not v then break end
+		table.insert(out, v)
+		local t, l, r = children(decode(v))
+		if t ~= 0 or #l ~= 32 or #r ~= 32 then break end
+		local b = string.byte(leaf, math.floor(level / 8) + 1) or 0
+		if math.floor(b / 2 ^ (level % 8)) % 2 == 1 then key = r else key = l end
+	end
+	return out
+end
+
+redis.register_function{function_name='` + pathFunction + `', callback=path, flags={'no-writes'}}
+`
+
+// ServerSidePathNodes returns what PathNodes does, but walks the path on the
+// server with a Redis Function, in a single round trip instead of one per
+// level. The function library is loaded with FUNCTION LOAD on first use. The
+// nodes are read from Redis rather than the root and node caches.
+//
+// The walk falls back to PathNodes on servers without Redis Functions, which
+// appeared in Redis 7, or that deny them, remembering not to try again, and
+// for stores whose key names or values the function can't read: those with a
+// key encoder, a compressor, a codec or a root codec, and those on Redis
+// Cluster without WithClusterHashTag, where the path may span several nodes.
+func (s *Storage) ServerSidePathNodes(ctx context.Context, leafKey []byte) ([]*merkletree.Node, error) {
+	if !s.serverSidePath() {
+		return s.PathNodes(ctx, leafKey)
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	vals, err := s.callPathFunction(ctx, leafKey)
+	if isUnsupportedCommand(err) {
+		s.noServerPath.Store(true)
+		return s.PathNodes(ctx, leafKey)
+	} else if err != nil {
+		return nil, newErr(err, "failed to walk path on the server")
+	}
+	if len(vals) == 0 {
+		return nil, merkletree.ErrKeyNotFound
+	}
+	var root merkletree.Hash
+	if err := s.decodeRoot(s.rootId, vals[0], &root); err != nil {
+		return nil, err
+	}
+	nodes := vals[1:]
+	return walkPath(&root, leafKey, func(*merkletree.Hash) (*merkletree.Node, error) {
+		// the function stops at the first missing node
+		if len(nodes) == 0 {
+			return nil, ErrNodeNotFound
+		}
+		item, err := s.decodeNodeItem(nodes[0])
+		nodes = nodes[1:]
+		if err != nil {
+			return nil, err
+		}
+		return item.Node()
+	})
+}
+
+// serverSidePath reports whether ServerSidePathNodes can walk the path on the
+// server.
+func (s *Storage) serverSidePath() bool {
+	if s.noServerPath.Load() || s.keyEncoder != nil || s.compressor != nil || s.codecTag != 0 || s.rootCodec != nil {
+		return false
+	}
+	_, cluster := s.db.(*redis.ClusterClient)
+	return !cluster || s.clusterHashTag
+}
+
+// callPathFunction calls pathFunction, loading the library first if the
+// server doesn't have it.
+func (s *Storage) callPathFunction(ctx context.Context, leafKey []byte) ([]string, error) {
+	hexFlag := "0"
+	if s.hexEncoding {
+		hexFlag = "1"
+	}
+	call := func() ([]string, error) {
+		return s.db.Do(ctx, "FCALL_RO", pathFunction, 1, s.rootId, s.nodeIdPrefix, leafKey, hexFlag, maxPathLevels).StringSlice()
+	}
+	vals, err := call()
+	if err == nil || !strings.HasPrefix(err.Error(), "ERR Function not found") {
+		return vals, err
+	}
+	if err := s.db.Do(ctx, "FUNCTION", "LOAD", "REPLACE", pathLibraryCode).Err(); err != nil {
+		return nil, err
+	}
+	return call()
+}
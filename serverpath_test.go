@@ -0,0 +1,145 @@
+package merkleredis
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func init() {
+	// emulates pathLibraryCode
+	fakeredis.RegisterFunction(pathLibrary, pathFunction, func(c *fakeredis.Conn, keys, argv [][]byte) {
+		prefix, leaf, hexed := string(argv[0]), argv[1], string(argv[2]) == "1"
+		decode := func(v []byte) []byte {
+			if hexed {
+				v, _ = hex.DecodeString(string(v))
+			}
+			return v
+		}
+		root := c.Srv.Lookup(string(keys[0]))
+		if root == nil {
+			c.WriteArrayLen(0)
+			return
+		}
+		out := [][]byte{root.Str}
+		key := decode(root.Str)
+		for level := 0; level < maxPathLevels; level++ {
+			if string(key) == string(merkletree.HashZero[:]) {
+				break
+			}
+			v := c.Srv.Lookup(prefix + hex.EncodeToString(key))
+			if v == nil {
+				break
+			}
+			out = append(out, v.Str)
+			item, err := UnmarshalNodeItem(decode(v.Str))
+			if err != nil || item.Type != byte(merkletree.NodeTypeMiddle) || len(item.ChildL) != hashLen || len(item.ChildR) != hashLen {
+				break
+			}
+			if merkletree.TestBit(leaf, uint(level)) {
+				key = item.ChildR
+			} else {
+				key = item.ChildL
+			}
+		}
+		c.WriteArrayLen(len(out))
+		for _, v := range out {
+			c.WriteBulk(v)
+		}
+	})
+}
+
+// checkServerSidePath checks that ServerSidePathNodes agrees with PathNodes
+// for keys in and out of the tree.
+func checkServerSidePath(t *testing.T, s *Storage) {
+	t.Helper()
+	ctx := context.Background()
+	for k := int64(0); k < 12; k++ {
+		kHash, err := merkletree.NewHashFromBigInt(big.NewInt(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, wantErr := s.PathNodes(ctx, kHash[:])
+		got, err := s.ServerSidePathNodes(ctx, kHash[:])
+		if !errors.Is(err, wantErr) && err != wantErr {
+			t.Fatalf("key %d: got error %v, want %v", k, err, wantErr)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("key %d: got %d nodes, want %d", k, len(got), len(want))
+		}
+	}
+}
+
+func TestServerSidePathNodes(t *testing.T) {
+	ctx := context.Background()
+	for _, opts := range [][]Option{nil, {WithHexEncoding(), WithCompactNodes()}} {
+		srv := fakeredis.New(t)
+		s := NewMerkleRedisStorage(srv.Client(t), "serverpath", opts...)
+
+		if path, err := s.ServerSidePathNodes(ctx, testHash(1)[:]); len(path) != 0 || !errors.Is(err, merkletree.ErrKeyNotFound) {
+			t.Fatalf("empty tree: got %d nodes, %v", len(path), err)
+		}
+		newTestTree(t, s, 8)
+		checkServerSidePath(t, s)
+		if n := srv.Count("FUNCTION"); n != 1 {
+			t.Fatalf("library loaded %d times, want once", n)
+		}
+		gets, calls := srv.Count("GET"), srv.Count("FCALL_RO")
+		if _, err := s.ServerSidePathNodes(ctx, testHash(1)[:]); err != nil && !errors.Is(err, merkletree.ErrKeyNotFound) {
+			t.Fatal(err)
+		}
+		if srv.Count("GET") != gets || srv.Count("FCALL_RO") != calls+1 {
+			t.Fatal("walk took more than one FCALL_RO")
+		}
+	}
+}
+
+func TestServerSidePathNodesMissingNode(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "serverpath")
+	mt := newTestTree(t, s, 8)
+
+	kHash, _ := merkletree.NewHashFromBigInt(big.NewInt(3))
+	path, err := s.PathNodes(ctx, kHash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ := path[1].Key()
+	srv.Delete(s.getRedisNodeIdForMerkleKey(h[:]))
+	s.nodeCache.purge()
+
+	got, err := s.ServerSidePathNodes(ctx, kHash[:])
+	if !errors.Is(err, ErrNodeNotFound) || len(got) != 1 {
+		t.Fatalf("got %d nodes, %v, want the root and ErrNodeNotFound", len(got), err)
+	}
+	if h, _ := got[0].Key(); *h != *mt.Root() {
+		t.Fatal("path doesn't start at the root")
+	}
+}
+
+func TestServerSidePathNodesFallback(t *testing.T) {
+	srv := fakeredis.New(t)
+	srv.Disable("FUNCTION")
+	srv.Disable("FCALL_RO")
+	s := NewMerkleRedisStorage(srv.Client(t), "serverpath")
+	newTestTree(t, s, 8)
+
+	checkServerSidePath(t, s)
+	if n := srv.Count("FCALL_RO"); n != 1 {
+		t.Fatalf("tried FCALL_RO %d times, want once", n)
+	}
+
+	// stores whose values the function can't read walk on the client
+	compressed := NewMerkleRedisStorage(srv.Client(t), "compressed", WithCompression(xorCompressor{}))
+	newTestTree(t, compressed, 8)
+	checkServerSidePath(t, compressed)
+	if n := srv.Count("FCALL_RO"); n != 1 {
+		t.Fatalf("compressed store sent FCALL_RO")
+	}
+}
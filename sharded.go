@@ -0,0 +1,78 @@
+package merkleredis
+
+import (
+	"context"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/dgryski/go-rendezvous"
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// ShardedStorage implements the db.Storage interface over several Redis
+// instances, for trees too large for a single one. Nodes are spread across the
+// shards by rendezvous hashing of their key, and the root is kept on the first
+// shard.
+//
+// Shards are identified by their position in the client list, so the list must
+// be given in the same order every time. Adding or removing a shard moves about
+// 1/N of the nodes to a different shard; existing data is not migrated.
+type ShardedStorage struct {
+	shards []*Storage
+	hash   *rendezvous.Rendezvous
+}
+
+// NewShardedStorage returns a ShardedStorage for the tree identified by prefix
+// over clients, which must not be empty. The options are applied to the Storage
+// of every shard.
+func NewShardedStorage(clients []redis.UniversalClient, prefix string, opts ...Option) *ShardedStorage {
+	names := make([]string, len(clients))
+	shards := make([]*Storage, len(clients))
+	for i, c := range clients {
+		names[i] = strconv.Itoa(i)
+		shards[i] = NewMerkleRedisStorageUniversal(c, prefix, opts...)
+	}
+	return &ShardedStorage{
+		shards: shards,
+		hash:   rendezvous.New(names, xxhash.Sum64String),
+	}
+}
+
+// shardIndex returns the index of the shard holding the node stored under key.
+func (s *ShardedStorage) shardIndex(key []byte) int {
+	i, _ := strconv.Atoi(s.hash.Lookup(hex.EncodeToString(key)))
+	return i
+}
+
+// Get retrieves the node stored under key from its shard.
+func (s *ShardedStorage) Get(ctx context.Context, key []byte) (*merkletree.Node, error) {
+	return s.shards[s.shardIndex(key)].Get(ctx, key)
+}
+
+// Put stores node under key on its shard.
+func (s *ShardedStorage) Put(ctx context.Context, key []byte, node *merkletree.Node) error {
+	return s.shards[s.shardIndex(key)].Put(ctx, key, node)
+}
+
+// GetRoot retrieves the root from the first shard.
+func (s *ShardedStorage) GetRoot(ctx context.Context) (*merkletree.Hash, error) {
+	return s.shards[0].GetRoot(ctx)
+}
+
+// SetRoot stores the root on the first shard.
+func (s *ShardedStorage) SetRoot(ctx context.Context, hash *merkletree.Hash) error {
+	return s.shards[0].SetRoot(ctx, hash)
+}
+
+// Close closes the Storage of every shard, returning the first error.
+func (s *ShardedStorage) Close() error {
+	var first error
+	for _, shard := range s.shards {
+		if err := shard.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
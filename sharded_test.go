@@ -0,0 +1,70 @@
+package merkleredis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+var _ merkletree.Storage = (*ShardedStorage)(nil)
+
+func TestShardedStorage(t *testing.T) {
+	ctx := context.Background()
+	srvs := make([]*fakeredis.Server, 3)
+	clients := make([]redis.UniversalClient, len(srvs))
+	for i := range srvs {
+		srvs[i] = fakeredis.New(t)
+		clients[i] = srvs[i].Client(t)
+	}
+	s := NewShardedStorage(clients, "sharded")
+
+	kvs := testLeafKVs(60)
+	perShard := make([]int, len(srvs))
+	for _, kv := range kvs {
+		if err := s.Put(ctx, kv.K, &kv.V); err != nil {
+			t.Fatal(err)
+		}
+		perShard[s.shardIndex(kv.K)]++
+	}
+	for i, srv := range srvs {
+		if n := len(srv.Keys()); n != perShard[i] {
+			t.Fatalf("shard %d holds %d keys, want %d", i, n, perShard[i])
+		}
+		if perShard[i] == 0 {
+			t.Fatalf("shard %d holds no nodes", i)
+		}
+	}
+
+	// a new store over the same clients finds every node where it was put
+	s2 := NewShardedStorage(clients, "sharded")
+	for _, kv := range kvs {
+		id := s.shards[0].getRedisNodeIdForMerkleKey(kv.K)
+		if _, ok := srvs[s2.shardIndex(kv.K)].Raw(id); !ok {
+			t.Fatalf("node %x not on shard %d", kv.K, s2.shardIndex(kv.K))
+		}
+		got, err := s2.Get(ctx, kv.K)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got.Entry[1] != *kv.V.Entry[1] {
+			t.Fatalf("node %x: got %+v, want %+v", kv.K, got, kv.V)
+		}
+	}
+
+	if err := s.SetRoot(ctx, testHash(5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srvs[0].Raw(s.shards[0].rootId); !ok {
+		t.Fatal("root not stored on the first shard")
+	}
+	root, err := s2.GetRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *root != *testHash(5) {
+		t.Fatalf("root: got %x", root[:])
+	}
+}
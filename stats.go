@@ -0,0 +1,163 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// statsSampleSize is the number of nodes Stats measures to estimate the memory
+// used by the tree.
+const statsSampleSize = 32
+
+// nodeKeyOverhead approximates the memory Redis uses for a key beyond its name
+// and value, for estimates made without MEMORY USAGE.
+const nodeKeyOverhead = 56
+
+// TreeStats summarizes a tree, see Stats.
+type TreeStats struct {
+	// NodeCount is the number of nodes, as returned by NodeCount.
+	NodeCount int64
+	// Root is the current root, or nil if none was set.
+	Root *merkletree.Hash
+	// ApproxBytes estimates the memory Redis uses for the nodes, from the
+	// MEMORY USAGE of a sample of them.
+	ApproxBytes int64
+}
+
+// Stats returns the node count, root and approximate memory use of the tree in
+// one call, for dashboards. The memory use is the average MEMORY USAGE of up to
+// statsSampleSize nodes, found with SCAN, times the node count, as computed by
+// MemoryUsage; it excludes the root, counter and history keys.
+func (s *Storage) Stats(ctx context.Context) (TreeStats, error) {
+	var stats TreeStats
+	n, err := s.NodeCount(ctx)
+	if err != nil {
+		return TreeStats{}, err
+	}
+	stats.NodeCount = n
+
+	root, err := s.GetRoot(ctx)
+	if err != nil && !errors.Is(err, merkletree.ErrNotFound) {
+		return TreeStats{}, err
+	}
+	stats.Root = root
+
+	if n > 0 {
+		avg, err := s.sampleNodeBytes(ctx, statsSampleSize)
+		if err != nil {
+			return TreeStats{}, err
+		}
+		stats.ApproxBytes = avg * n
+	}
+	return stats, nil
+}
+
+// MemoryUsage estimates the memory Redis uses for the nodes of the tree, for
+// capacity planning: the average MEMORY USAGE of up to sampleSize nodes, the
+// first ones returned by SCAN, times the node count. Servers without MEMORY
+// USAGE, such as Redis before 4.0 or deployments whose ACLs deny it, get an
+// estimate from the length of each sampled key and value instead. sampleSize
+// <= 0 samples as many nodes as Stats does. Like Stats it excludes the root,
+// counter and history keys.
+func (s *Storage) MemoryUsage(ctx context.Context, sampleSize int) (int64, error) {
+	if sampleSize <= 0 {
+		sampleSize = statsSampleSize
+	}
+	n, err := s.NodeCount(ctx)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	avg, err := s.sampleNodeBytes(ctx, sampleSize)
+	if err != nil {
+		return 0, err
+	}
+	return avg * n, nil
+}
+
+// sampleNodeBytes returns the average MEMORY USAGE of the first size node keys
+// returned by SCAN, or 0 if there are none. It falls back to
+// estimateNodeBytes if the server doesn't support MEMORY USAGE.
+func (s *Storage) sampleNodeBytes(ctx context.Context, size int) (int64, error) {
+	var sample []string
+	err := s.scanNodeKeys(ctx, func(keys []string) error {
+		sample = append(sample, keys...)
+		if len(sample) >= size {
+			sample = sample[:size]
+			return errStopScan
+		}
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return 0, err
+	}
+	if len(sample) == 0 {
+		return 0, nil
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	pipe := s.db.Pipeline()
+	cmds := make([]*redis.IntCmd, len(sample))
+	for i, k := range sample {
+		cmds[i] = pipe.MemoryUsage(ctx, k)
+	}
+	if _, err := pipe.Exec(ctx); isUnsupportedCommand(err) {
+		return s.estimateNodeBytes(ctx, sample)
+	} else if err != nil && err != redis.Nil {
+		return 0, newErr(err, "failed to measure nodes")
+	}
+	var total, measured int64
+	for _, cmd := range cmds {
+		// keys deleted since the scan are skipped
+		if cmd.Err() == redis.Nil {
+			continue
+		}
+		total += cmd.Val()
+		measured++
+	}
+	if measured == 0 {
+		return 0, nil
+	}
+	return total / measured, nil
+}
+
+// estimateNodeBytes returns the average length of the name and value of the
+// keys plus nodeKeyOverhead, a stand-in for MEMORY USAGE.
+func (s *Storage) estimateNodeBytes(ctx context.Context, keys []string) (int64, error) {
+	pipe := s.db.Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, k := range keys {
+		cmds[i] = pipe.StrLen(ctx, k)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, newErr(err, "failed to measure nodes")
+	}
+	var total, measured int64
+	for i, cmd := range cmds {
+		// STRLEN reports 0 for keys deleted since the scan
+		if cmd.Val() == 0 {
+			continue
+		}
+		total += int64(len(keys[i])) + cmd.Val() + nodeKeyOverhead
+		measured++
+	}
+	if measured == 0 {
+		return 0, nil
+	}
+	return total / measured, nil
+}
+
+// isUnsupportedCommand reports whether err is the reply of a server that
+// doesn't know a command, or whose ACLs deny it.
+func isUnsupportedCommand(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.HasPrefix(msg, "ERR unknown command") || strings.HasPrefix(msg, "NOPERM")
+}
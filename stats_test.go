@@ -0,0 +1,85 @@
+package merkleredis
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "stats")
+
+	stats, err := s.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NodeCount != 0 || stats.Root != nil || stats.ApproxBytes != 0 {
+		t.Fatalf("empty tree: got %+v", stats)
+	}
+
+	tree := newTestTree(t, s, 50)
+	stats, err = s.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := s.NodeCount(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NodeCount != n || n < 50 {
+		t.Fatalf("NodeCount: got %d, want %d", stats.NodeCount, n)
+	}
+	if stats.Root == nil || *stats.Root != *tree.Root() {
+		t.Fatalf("Root: got %v, want %v", stats.Root, tree.Root())
+	}
+	// every node takes at least its hex key, and far less than 1KiB
+	if lo := n * int64(len(s.nodeIdPrefix)+64); stats.ApproxBytes < lo {
+		t.Fatalf("ApproxBytes: got %d, want at least %d", stats.ApproxBytes, lo)
+	}
+	if hi := n * 1024; stats.ApproxBytes > hi {
+		t.Fatalf("ApproxBytes: got %d, want at most %d", stats.ApproxBytes, hi)
+	}
+	if got := srv.Count("MEMORY"); got != statsSampleSize {
+		t.Fatalf("measured %d nodes, want %d", got, statsSampleSize)
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "memusage")
+
+	if got, err := s.MemoryUsage(ctx, 10); err != nil || got != 0 {
+		t.Fatalf("empty tree: got %d, %v", got, err)
+	}
+
+	newTestTree(t, s, 50)
+	n, err := s.NodeCount(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every node takes at least its hex key, and far less than 1KiB
+	lo, hi := n*int64(len(s.nodeIdPrefix)+64), n*1024
+	measured, err := s.MemoryUsage(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if measured < lo || measured > hi {
+		t.Fatalf("MemoryUsage: got %d, want between %d and %d", measured, lo, hi)
+	}
+	if got := srv.Count("MEMORY"); got != 10 {
+		t.Fatalf("measured %d nodes, want 10", got)
+	}
+
+	// servers without MEMORY USAGE get an estimate from the stored lengths
+	srv.Disable("MEMORY")
+	estimated, err := s.MemoryUsage(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimated < lo || estimated > hi {
+		t.Fatalf("estimated MemoryUsage: got %d, want between %d and %d", estimated, lo, hi)
+	}
+	if got := srv.Count("STRLEN"); got != 10 {
+		t.Fatalf("estimated %d nodes, want 10", got)
+	}
+}
@@ -0,0 +1,150 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/go-redis/redis/v9"
+)
+
+// blockingClient is a client whose reads never complete until their context
+// is done, like a wedged server on a client that honours contexts.
+type blockingClient struct {
+	redis.UniversalClient
+}
+
+func (blockingClient) Get(ctx context.Context, key string) *redis.StringCmd {
+	cmd := redis.NewStringCmd(ctx, "get", key)
+	<-ctx.Done()
+	cmd.SetErr(ctx.Err())
+	return cmd
+}
+
+func TestOperationTimeout(t *testing.T) {
+	s := NewMerkleRedisStorageUniversal(blockingClient{}, "timeout", WithOperationTimeout(20*time.Millisecond))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Get(context.Background(), []byte("k"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get did not time out")
+	}
+}
+
+// cancelAfter cancels a context once a client has sent n commands named name,
+// alone or in pipelines.
+type cancelAfter struct {
+	name   string
+	n      int
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	seen int
+}
+
+func (h *cancelAfter) count(cmds ...redis.Cmder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, cmd := range cmds {
+		if cmd.Name() == h.name {
+			if h.seen++; h.seen == h.n {
+				h.cancel()
+			}
+		}
+	}
+}
+
+func (h *cancelAfter) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *cancelAfter) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		h.count(cmd)
+		return err
+	}
+}
+
+func (h *cancelAfter) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		h.count(cmds...)
+		return err
+	}
+}
+
+func TestCancelMidScan(t *testing.T) {
+	srv := fakeredis.New(t)
+	seed := NewMerkleRedisStorage(srv.Client(t), "cancel")
+	kvs := testLeafKVs(20 * defaultScanBatch)
+	if err := seed.PutBatch(context.Background(), kvs); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		cmd  string
+		op   func(ctx context.Context, s *Storage) error
+	}{
+		{"List", "scan", func(ctx context.Context, s *Storage) error {
+			_, err := s.List(ctx, 0)
+			return err
+		}},
+		{"NodeCount", "scan", func(ctx context.Context, s *Storage) error {
+			_, err := s.NodeCount(ctx)
+			return err
+		}},
+		{"ListTrees", "scan", func(ctx context.Context, s *Storage) error {
+			_, err := ListTrees(ctx, s.db.(*redis.Client))
+			return err
+		}},
+		{"Clone", "scan", func(ctx context.Context, s *Storage) error {
+			_, err := s.Clone(ctx, "cancel_clone")
+			return err
+		}},
+		{"PutBatch", "set", func(ctx context.Context, s *Storage) error {
+			// the first batch cancels the context, so the second never starts
+			for _, batch := range [][]KV{kvs[:10], kvs[10:20]} {
+				if err := s.PutBatch(ctx, batch); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		// Reset runs last, as it removes the nodes
+		{"Reset", "del", func(ctx context.Context, s *Storage) error {
+			return s.Reset(ctx)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			client := srv.Client(t)
+			hook := &cancelAfter{name: tc.cmd, n: 3, cancel: cancel}
+			client.AddHook(hook)
+			s := NewMerkleRedisStorage(client, "cancel")
+
+			if err := tc.op(ctx, s); !errors.Is(err, context.Canceled) {
+				t.Fatalf("got %v, want context.Canceled", err)
+			}
+			hook.mu.Lock()
+			defer hook.mu.Unlock()
+			if hook.seen > hook.n+defaultScanBatch {
+				t.Fatalf("%d %s commands sent after cancellation", hook.seen-hook.n, tc.cmd)
+			}
+		})
+	}
+	if n, err := seed.NodeCount(context.Background()); err != nil || n == 0 || n == int64(len(kvs)) {
+		t.Fatalf("Reset: %d of %d nodes left, %v; want it to stop part way", n, len(kvs), err)
+	}
+}
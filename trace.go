@@ -0,0 +1,43 @@
+package merkleredis
+
+import "context"
+
+// Tracer starts a span around every Get, Put, GetRoot and SetRoot, see
+// WithTracer. It covers the part of a tracing API such as OpenTelemetry's that
+// the store needs, so an adapter only has to map Start to trace.Tracer.Start
+// and the attributes to attribute.KeyValues.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span, recording err on it if it is not nil.
+	End(err error)
+}
+
+// Attribute is a span attribute. Value is a string or an int.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// WithTracer wraps every Get, Put, GetRoot and SetRoot in a span of t, with
+// the attributes merkle.op, the operation, redis.key, the Redis key it
+// accesses, and merkle.key_len, the length of the merkle key for node
+// operations. Without a Tracer no span is created.
+func WithTracer(t Tracer) Option {
+	return func(s *Storage) {
+		s.tracer = t
+	}
+}
+
+// startSpan starts the span of operation op on the Redis key id. The caller
+// must check that s.tracer is set.
+func (s *Storage) startSpan(ctx context.Context, op, id string, key []byte) (context.Context, Span) {
+	attrs := []Attribute{{"merkle.op", op}, {"redis.key", id}}
+	if key != nil {
+		attrs = append(attrs, Attribute{"merkle.key_len", len(key)})
+	}
+	return s.tracer.Start(ctx, "merkleredis."+op, attrs...)
+}
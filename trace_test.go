@@ -0,0 +1,98 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+// spanRecorder is a Tracer keeping every span in memory.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	span := &recordedSpan{name: name, attrs: map[string]interface{}{}}
+	for _, a := range attrs {
+		span.attrs[a.Key] = a.Value
+	}
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+	return ctx, &recorderSpan{r, span}
+}
+
+type recorderSpan struct {
+	r    *spanRecorder
+	span *recordedSpan
+}
+
+func (s *recorderSpan) End(err error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.span.err = err
+	s.span.ended = true
+}
+
+func TestTracer(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	r := &spanRecorder{}
+	s := NewMerkleRedisStorage(srv.Client(t), "trace", WithTracer(r))
+
+	key := []byte("k")
+	if err := s.Put(ctx, key, merkletree.NewNodeLeaf(testHash(1), testHash(2))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, []byte("absent")); !errors.Is(err, merkletree.ErrNotFound) {
+		t.Fatal(err)
+	}
+	if err := s.SetRoot(ctx, testHash(3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetRoot(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name string
+		key  string
+		err  error
+	}{
+		{"merkleredis.Put", s.getRedisNodeIdForMerkleKey(key), nil},
+		{"merkleredis.Get", s.getRedisNodeIdForMerkleKey(key), nil},
+		{"merkleredis.Get", s.getRedisNodeIdForMerkleKey([]byte("absent")), ErrNodeNotFound},
+		{"merkleredis.SetRoot", s.rootId, nil},
+		{"merkleredis.GetRoot", s.rootId, nil},
+	}
+	if len(r.spans) != len(want) {
+		t.Fatalf("got %d spans, want %d", len(r.spans), len(want))
+	}
+	for i, w := range want {
+		span := r.spans[i]
+		if span.name != w.name || span.attrs["redis.key"] != w.key || !errors.Is(span.err, w.err) || !span.ended {
+			t.Fatalf("span %d: got %+v, want %+v", i, span, w)
+		}
+		if op := "merkleredis." + span.attrs["merkle.op"].(string); op != w.name {
+			t.Fatalf("span %d: merkle.op %q", i, op)
+		}
+	}
+	if n := r.spans[0].attrs["merkle.key_len"]; n != len(key) {
+		t.Fatalf("merkle.key_len: got %v, want %d", n, len(key))
+	}
+}
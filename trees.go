@@ -0,0 +1,67 @@
+package merkleredis
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// rootKeySuffixes are the suffixes of the keys stored next to the root key of
+// a tree.
+var rootKeySuffixes = []string{nodeCountSuffix, lockSuffix, rootHistorySuffix, rootTimestampSuffix, formatSuffix, versionSuffix}
+
+// ListTrees returns the sorted prefixes of the trees stored in the database of
+// client, found by scanning for root keys. A tree is listed once it has a root
+// or any of the keys stored next to it, such as a node counter, but not if it
+// only has nodes. Keys of prefixes ending in one of those keys' suffixes, such
+// as "_count", are taken for keys of the tree without the suffix, and keys of
+// prefixes containing "#l#" for labeled roots of the tree before it. Prefixes
+// wrapped in a hash tag by WithClusterHashTag are returned without it, and
+// trees created with NewMerkleRedisStorageWithID are listed as the prefix, "#"
+// and the ID.
+func ListTrees(ctx context.Context, client *redis.Client) ([]string, error) {
+	found := map[string]bool{}
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		keys, next, err := client.Scan(ctx, cursor, merkleTreeRootBase+"*", defaultScanBatch).Result()
+		if err != nil {
+			return nil, newErr(err, "failed to scan root keys")
+		}
+		for _, k := range keys {
+			found[treePrefix(strings.TrimPrefix(k, merkleTreeRootBase))] = true
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	prefixes := make([]string, 0, len(found))
+	for p := range found {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+	return prefixes, nil
+}
+
+// treePrefix returns the prefix of the tree that the key named by
+// merkleTreeRootBase followed by name belongs to.
+func treePrefix(name string) string {
+	if i := strings.Index(name, labeledRootInfix); i >= 0 {
+		name = name[:i]
+	} else {
+		for _, suffix := range rootKeySuffixes {
+			if strings.HasSuffix(name, suffix) {
+				name = strings.TrimSuffix(name, suffix)
+				break
+			}
+		}
+	}
+	if strings.HasPrefix(name, "{") && strings.HasSuffix(name, "}") {
+		name = name[1 : len(name)-1]
+	}
+	return name
+}
@@ -0,0 +1,38 @@
+package merkleredis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+)
+
+func TestListTrees(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	client := srv.Client(t)
+
+	if trees, err := ListTrees(ctx, client); err != nil || len(trees) != 0 {
+		t.Fatalf("empty database: got %v, %v", trees, err)
+	}
+
+	newTestTree(t, NewMerkleRedisStorage(client, "accounts", WithRootHistory(2)), 3)
+	newTestTree(t, NewMerkleRedisStorage(client, "claims", WithNodeCounter()), 3)
+	tagged := NewMerkleRedisStorage(client, "tagged", WithClusterHashTag(true))
+	if err := tagged.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	// nodes alone don't make a tree
+	if err := NewMerkleRedisStorage(client, "rootless").PutBatch(ctx, testLeafKVs(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	trees, err := ListTrees(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"accounts", "claims", "tagged"}; !reflect.DeepEqual(trees, want) {
+		t.Fatalf("got %q, want %q", trees, want)
+	}
+}
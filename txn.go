@@ -0,0 +1,213 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// ErrTxnDone is returned by the methods of a Txn once it was committed or
+// discarded.
+var ErrTxnDone = errors.New("transaction already committed or discarded")
+
+// Txn buffers node and root writes to apply them together, see Begin. It
+// implements the merkletree storage interface, so a merkletree.MerkleTree can
+// be opened over it to stage a multi-step mutation. A Txn is not safe for
+// concurrent use.
+type Txn struct {
+	s *Storage
+	// writes holds the buffered nodes in the order they were first put, and
+	// index their position by key.
+	writes []txnWrite
+	index  map[string]int
+	// root and rootValue are the buffered root and its encoded value, nil if
+	// SetRoot wasn't called.
+	root      *merkletree.Hash
+	rootValue interface{}
+	done      bool
+}
+
+var _ merkletree.Storage = (*Txn)(nil)
+
+type txnWrite struct {
+	item  *NodeItem
+	node  *merkletree.Node
+	value interface{}
+}
+
+// Begin starts a transaction on the store. Nothing is sent to Redis until
+// Commit, which writes the buffered nodes and then the root in a single
+// MULTI/EXEC, so other clients see either all of the writes or none. Reads
+// through the Txn see its buffered writes. Reads aren't isolated: keys read
+// aren't watched, so Commit overwrites a root another writer set in the
+// meantime. On Redis Cluster all keys must hash to the same slot, see
+// WithClusterHashTag.
+func (s *Storage) Begin(ctx context.Context) (*Txn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &Txn{s: s, index: map[string]int{}}, nil
+}
+
+// Get returns the node buffered under key, or reads it from the store.
+func (t *Txn) Get(ctx context.Context, key []byte) (*merkletree.Node, error) {
+	if t.done {
+		return nil, ErrTxnDone
+	}
+	if i, ok := t.index[string(key)]; ok {
+		return t.writes[i].node, nil
+	}
+	return t.s.Get(ctx, key)
+}
+
+// Put buffers node under key, replacing any node buffered under it before.
+// The node is encoded right away, so encoding errors are returned here rather
+// than by Commit.
+func (t *Txn) Put(ctx context.Context, key []byte, node *merkletree.Node) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	item, err := NewNodeItemFromNode(key, node)
+	if err != nil {
+		return err
+	}
+	v, err := t.s.encodeNodeItem(item)
+	if err != nil {
+		return err
+	}
+	w := txnWrite{item: item, node: node, value: v}
+	if i, ok := t.index[string(key)]; ok {
+		t.writes[i] = w
+		return nil
+	}
+	t.index[string(key)] = len(t.writes)
+	t.writes = append(t.writes, w)
+	return nil
+}
+
+// GetRoot returns the buffered root, or reads it from the store.
+func (t *Txn) GetRoot(ctx context.Context) (*merkletree.Hash, error) {
+	if t.done {
+		return nil, ErrTxnDone
+	}
+	if t.root != nil {
+		root := *t.root
+		return &root, nil
+	}
+	return t.s.GetRoot(ctx)
+}
+
+// SetRoot buffers hash as the root to set on Commit. With WithStrictSetRoot
+// its node must be buffered or stored already.
+func (t *Txn) SetRoot(ctx context.Context, hash *merkletree.Hash) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	if _, ok := t.index[string(hash[:])]; !ok {
+		ctx, cancel := t.s.withTimeout(ctx)
+		defer cancel()
+		if err := t.s.checkRootNode(ctx, hash); err != nil {
+			return err
+		}
+	}
+	v, err := t.s.encodeRoot(hash)
+	if err != nil {
+		return err
+	}
+	root := *hash
+	t.root, t.rootValue = &root, v
+	return nil
+}
+
+// Commit writes the buffered nodes and root in a single MULTI/EXEC. The Txn
+// can't be used afterwards, even if Commit fails.
+func (t *Txn) Commit(ctx context.Context) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	t.done = true
+	s := t.s
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var items []*NodeItem
+	if s.wal != nil {
+		for _, w := range t.writes {
+			items = append(items, w.item)
+		}
+	}
+	seq, err := s.logWrites(items, t.root)
+	if err != nil {
+		return err
+	}
+
+	s.rootMu.Lock()
+	defer s.rootMu.Unlock()
+	pipe := s.db.TxPipeline()
+	cmds := make([]*redis.StatusCmd, len(t.writes))
+	for i, w := range t.writes {
+		id := s.getRedisNodeIdForMerkleKey(w.item.Key)
+		if s.nodeCounter {
+			cmds[i] = pipe.SetArgs(ctx, id, w.value, redis.SetArgs{TTL: s.ttl, Get: true})
+		} else {
+			cmds[i] = pipe.Set(ctx, id, w.value, s.ttl)
+		}
+	}
+	// the format version is recorded with the root, so that a failed
+	// commit leaves nothing behind
+	recordFormat := t.root != nil && !s.formatRecorded.Load()
+	if recordFormat {
+		pipe.SetNX(ctx, s.rootId+formatSuffix, s.expectedFormat(), s.ttl)
+	}
+	if t.root != nil {
+		pipe.Set(ctx, s.rootId, t.rootValue, s.ttl)
+		pipe.Set(ctx, s.rootId+rootTimestampSuffix, time.Now().UnixNano(), s.ttl)
+		pipe.Incr(ctx, s.rootId+versionSuffix)
+		if s.rootHistory > 0 {
+			s.pushRootHistory(ctx, pipe, t.rootValue)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return s.abortWrites(seq, newErr(err, "failed to commit transaction"))
+	}
+	if recordFormat {
+		s.formatRecorded.Store(true)
+	}
+	if err := s.wal.ack(seq); err != nil {
+		return err
+	}
+	for _, w := range t.writes {
+		s.nodeCache.add(w.item.Key, w.node)
+	}
+	if t.root != nil {
+		s.cacheRoot(t.root)
+	}
+	if s.nodeCounter {
+		var added int64
+		for _, cmd := range cmds {
+			if cmd.Err() == redis.Nil {
+				added++
+			}
+		}
+		if added > 0 {
+			if err := s.db.IncrBy(ctx, s.rootId+nodeCountSuffix, added).Err(); err != nil {
+				return newErr(err, "failed to update node count")
+			}
+		}
+	}
+	return nil
+}
+
+// Discard drops the buffered writes without sending anything to Redis. The Txn
+// can't be used afterwards.
+func (t *Txn) Discard() {
+	t.done = true
+	t.writes, t.index = nil, nil
+	t.root, t.rootValue = nil, nil
+}
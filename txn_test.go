@@ -0,0 +1,131 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestTxnDiscard(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "txn")
+
+	txn, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kvs := testLeafKVs(3)
+	for i := range kvs {
+		if err := txn.Put(ctx, kvs[i].K, &kvs[i].V); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := txn.SetRoot(ctx, testHash(7)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the txn sees its writes, the store doesn't
+	if node, err := txn.Get(ctx, kvs[1].K); err != nil || node != &kvs[1].V {
+		t.Fatalf("txn Get: got %v, %v", node, err)
+	}
+	if root, err := txn.GetRoot(ctx); err != nil || *root != *testHash(7) {
+		t.Fatalf("txn GetRoot: got %v, %v", root, err)
+	}
+	if _, err := s.Get(ctx, kvs[1].K); !errors.Is(err, ErrNodeNotFound) {
+		t.Fatalf("store Get: got %v, want ErrNodeNotFound", err)
+	}
+
+	txn.Discard()
+	if keys := srv.Keys(); len(keys) != 0 {
+		t.Fatalf("Discard left %v", keys)
+	}
+	if _, err := s.GetRoot(ctx); err != merkletree.ErrNotFound {
+		t.Fatalf("GetRoot after Discard: got %v, want ErrNotFound", err)
+	}
+	if err := txn.Put(ctx, kvs[0].K, &kvs[0].V); err != ErrTxnDone {
+		t.Fatalf("Put after Discard: got %v, want ErrTxnDone", err)
+	}
+	if err := txn.Commit(ctx); err != ErrTxnDone {
+		t.Fatalf("Commit after Discard: got %v, want ErrTxnDone", err)
+	}
+}
+
+func TestTxnCommit(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newTestStorage(t, "txn")
+
+	txn, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// build a tree over the txn, which buffers every node and root it writes
+	mt, err := merkletree.NewMerkleTree(ctx, txn, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := mt.Add(ctx, big.NewInt(int64(i)), big.NewInt(int64(i)*10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := srv.Count("SET"); n != 0 {
+		t.Fatalf("%d SETs sent before Commit", n)
+	}
+
+	if err := txn.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Count("MULTI") != 1 || srv.Count("EXEC") != 1 {
+		t.Fatalf("sent %d MULTI and %d EXEC, want one of each", srv.Count("MULTI"), srv.Count("EXEC"))
+	}
+	if err := txn.Commit(ctx); err != ErrTxnDone {
+		t.Fatalf("second Commit: got %v, want ErrTxnDone", err)
+	}
+
+	// every write landed: a fresh store opens the same tree and proves a leaf
+	fresh := NewMerkleRedisStorage(srv.Client(t), "txn")
+	checkRoot(t, fresh, mt.Root())
+	if problems, err := fresh.VerifyIntegrity(ctx); err != nil || len(problems) != 0 {
+		t.Fatalf("VerifyIntegrity: got %v, %v", problems, err)
+	}
+	reopened, err := merkletree.NewMerkleTree(ctx, fresh, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, v, _, err := reopened.Get(ctx, big.NewInt(3)); err != nil || v.Int64() != 30 {
+		t.Fatalf("Get: got %v, %v", v, err)
+	}
+}
+
+func TestTxnCommitAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	s := NewMerkleRedisStorage(srv.Client(t), "txn", WithRootHistory(4))
+
+	txn, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kvs := testLeafKVs(3)
+	for i := range kvs {
+		if err := txn.Put(ctx, kvs[i].K, &kvs[i].V); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := txn.SetRoot(ctx, testHash(7)); err != nil {
+		t.Fatal(err)
+	}
+	// the root history write is rejected when queued, which aborts the
+	// node and root writes queued with it
+	srv.Disable("LPUSH")
+	if err := txn.Commit(ctx); err == nil {
+		t.Fatal("Commit: got nil error")
+	}
+	if keys := srv.Keys(); len(keys) != 0 {
+		t.Fatalf("failed Commit left %v", keys)
+	}
+}
@@ -0,0 +1,38 @@
+package merkleredis
+
+import (
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// ValidatePut checks that node, stored under key, survives the round trip
+// through this store's encoding that Put and Get make, without writing
+// anything: it converts the node to a NodeItem, encodes it with the store's
+// format, compressor and size limit, decodes it back and converts it to a
+// node again, returning the first error. It suits checking imported data of
+// uncertain provenance before committing any of it.
+func (s *Storage) ValidatePut(key []byte, node *merkletree.Node) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	item, err := NewNodeItemFromNode(key, node)
+	if err != nil {
+		return err
+	}
+	v, err := s.encodeNodeItem(item)
+	if err != nil {
+		return err
+	}
+	var raw string
+	switch v := v.(type) {
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	}
+	decoded, err := s.decodeNodeItem(raw)
+	if err != nil {
+		return err
+	}
+	_, err = decoded.Node()
+	return err
+}
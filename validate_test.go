@@ -0,0 +1,51 @@
+package merkleredis
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+func TestValidatePut(t *testing.T) {
+	srv := fakeredis.New(t)
+	leaf := merkletree.NewNodeLeaf(testHash(1), testHash(2))
+	middle := merkletree.NewNodeMiddle(testHash(3), testHash(4))
+	for _, opts := range [][]Option{
+		nil,
+		{WithHexEncoding()},
+		{WithCompactNodes()},
+		{WithCodec(CodecGzip, nil)},
+	} {
+		s := NewMerkleRedisStorage(srv.Client(t), "validate", opts...)
+		for _, node := range []*merkletree.Node{leaf, middle, merkletree.NewNodeEmpty()} {
+			if err := s.ValidatePut(testHash(5)[:], node); err != nil {
+				t.Fatalf("node type %d: %v", node.Type, err)
+			}
+		}
+	}
+
+	s := NewMerkleRedisStorage(srv.Client(t), "validate")
+	// a middle node missing a child encodes, but doesn't decode to a node
+	if err := s.ValidatePut(testHash(5)[:], &merkletree.Node{Type: merkletree.NodeTypeMiddle, ChildL: testHash(3)}); !errors.Is(err, ErrCorruptNode) {
+		t.Fatalf("middle node without ChildR: got %v, want ErrCorruptNode", err)
+	}
+	if err := s.ValidatePut(testHash(5)[:], &merkletree.Node{Type: merkletree.NodeTypeLeaf, Entry: [2]*merkletree.Hash{testHash(1), nil}}); !errors.Is(err, merkletree.ErrNodeBytesBadSize) {
+		t.Fatalf("incomplete entry: got %v, want ErrNodeBytesBadSize", err)
+	}
+	if err := s.ValidatePut(testHash(5)[:], &merkletree.Node{Type: 9}); !errors.Is(err, ErrCorruptNode) {
+		t.Fatalf("unknown type: got %v, want ErrCorruptNode", err)
+	}
+	if err := s.ValidatePut(nil, leaf); err != ErrEmptyKey {
+		t.Fatalf("empty key: got %v, want ErrEmptyKey", err)
+	}
+	small := NewMerkleRedisStorage(srv.Client(t), "validate", WithMaxNodeBytes(8))
+	if err := small.ValidatePut(testHash(5)[:], leaf); !errors.Is(err, ErrNodeTooLarge) {
+		t.Fatalf("oversized node: got %v, want ErrNodeTooLarge", err)
+	}
+
+	if keys := srv.Keys(); len(keys) != 0 {
+		t.Fatalf("ValidatePut wrote %v", keys)
+	}
+}
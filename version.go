@@ -0,0 +1,54 @@
+package merkleredis
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// versionSuffix is appended to the root key to form the tree version counter.
+const versionSuffix = "_ver"
+
+// TreeVersion returns the version of the tree, a counter incremented each time
+// its root is written or removed, and 0 for a tree whose root never was. It
+// only ever grows, so a consumer caching proofs can poll it instead of
+// comparing roots: the tree is unchanged while the version is. The counter
+// has no expiry, unlike the other keys under WithTTL, and is only reset by
+// Clear.
+//
+// SetRoot, RevertRoot and a committed Txn increment it in the same pipeline
+// as the root; CompareAndSetRoot, CommitRoot, Promote and Reset in a separate
+// command right after, so a failure in between can leave the root changed
+// with the version not yet incremented.
+func (s *Storage) TreeVersion(ctx context.Context) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	v, err := s.db.Get(ctx, s.rootId+versionSuffix).Result()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, newErr(err, "failed to read tree version")
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, newErr(err, "invalid tree version")
+	}
+	return n, nil
+}
+
+// recordRootWrite follows a root write that couldn't queue them itself: it
+// increments the tree version and, with WithRootHistory, records v, the root
+// written, in the history.
+func (s *Storage) recordRootWrite(ctx context.Context, v interface{}) error {
+	pipe := s.db.Pipeline()
+	pipe.Incr(ctx, s.rootId+versionSuffix)
+	if s.rootHistory > 0 && v != nil {
+		s.pushRootHistory(ctx, pipe, v)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return newErr(err, "failed to record root write")
+	}
+	return nil
+}
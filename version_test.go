@@ -0,0 +1,64 @@
+package merkleredis
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTreeVersion(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStorage(t, "version")
+
+	checkVersion := func(want int64) {
+		t.Helper()
+		if v, err := s.TreeVersion(ctx); err != nil || v != want {
+			t.Fatalf("got version %d, %v, want %d", v, err, want)
+		}
+	}
+	checkVersion(0)
+	for i := byte(1); i <= 3; i++ {
+		if err := s.SetRoot(ctx, testHash(i)); err != nil {
+			t.Fatal(err)
+		}
+		checkVersion(int64(i))
+		// stable between writes, whatever else happens
+		if err := s.PutBatch(ctx, testLeafKVs(2)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetRoot(ctx); err != nil {
+			t.Fatal(err)
+		}
+		checkVersion(int64(i))
+	}
+
+	if ok, err := s.CompareAndSetRoot(ctx, testHash(1), testHash(4)); err != nil || ok {
+		t.Fatalf("CompareAndSetRoot of a stale root: got %v, %v", ok, err)
+	}
+	checkVersion(3)
+	if ok, err := s.CompareAndSetRoot(ctx, testHash(3), testHash(4)); err != nil || !ok {
+		t.Fatalf("CompareAndSetRoot: got %v, %v", ok, err)
+	}
+	checkVersion(4)
+
+	txn, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.SetRoot(ctx, testHash(5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	checkVersion(5)
+
+	// removing the root is a change too
+	if err := s.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	checkVersion(6)
+	if err := s.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	checkVersion(0)
+}
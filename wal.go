@@ -0,0 +1,344 @@
+package merkleredis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/iden3/go-merkletree-sql/v2"
+)
+
+// WAL record types.
+const (
+	walRecordNode  byte = 'n'
+	walRecordRoot  byte = 'r'
+	walRecordAck   byte = 'a'
+	walRecordAbort byte = 'x'
+)
+
+// walHeaderLen is the length of a WAL record header: a type byte, a uint64 LE
+// sequence number and a uint32 LE payload length.
+const walHeaderLen = 13
+
+// ErrCorruptWAL is returned by Recover and Checkpoint for a write-ahead log
+// that can't be parsed.
+var ErrCorruptWAL = errors.New("corrupted write-ahead log")
+
+// walRecord is a node or root write recorded in the write-ahead log. Records
+// written together share a sequence number, which an ack record marks as
+// written to Redis and an abort record as failed.
+type walRecord struct {
+	typ     byte
+	seq     uint64
+	payload []byte
+}
+
+// wal is the write-ahead log of a Storage, see WithWAL. A nil *wal logs
+// nothing.
+type wal struct {
+	path string
+	// mu guards f and seq, and serializes appends with Recover and
+	// Checkpoint.
+	mu  sync.Mutex
+	f   *os.File
+	seq uint64
+}
+
+// open opens the log file if it isn't yet, continuing its sequence numbers.
+// The caller must hold w.mu.
+func (w *wal) open() error {
+	if w.f != nil {
+		return nil
+	}
+	f, err := os.OpenFile(w.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return newErr(err, "failed to open write-ahead log")
+	}
+	records, size, err := readWALRecords(f)
+	if err == nil {
+		// drop a record cut short by a crash, so appends start on a record
+		// boundary
+		err = f.Truncate(size)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	for _, r := range records {
+		if r.seq > w.seq {
+			w.seq = r.seq
+		}
+	}
+	w.f = f
+	return nil
+}
+
+// log appends records under a new sequence number and syncs the file, so they
+// survive a crash once it returns. It returns the sequence number to ack.
+func (w *wal) log(records ...walRecord) (uint64, error) {
+	if w == nil {
+		return 0, nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.open(); err != nil {
+		return 0, err
+	}
+	w.seq++
+	var buf bytes.Buffer
+	for _, r := range records {
+		r.seq = w.seq
+		writeWALRecord(&buf, r)
+	}
+	if _, err := w.f.Write(buf.Bytes()); err != nil {
+		return 0, newErr(err, "failed to append to write-ahead log")
+	}
+	if err := w.f.Sync(); err != nil {
+		return 0, newErr(err, "failed to sync write-ahead log")
+	}
+	return w.seq, nil
+}
+
+// ack records that the writes logged under seq reached Redis. Acks aren't
+// synced: losing one only makes Recover replay writes that are already there.
+func (w *wal) ack(seq uint64) error {
+	return w.settle(walRecordAck, seq, false)
+}
+
+// abort records that the writes logged under seq failed, so that Recover
+// doesn't replay them over later writes. Aborts are synced, as losing one
+// could make Recover regress the root to one whose write was reported failed.
+func (w *wal) abort(seq uint64) error {
+	return w.settle(walRecordAbort, seq, true)
+}
+
+// settle appends a record of type typ for seq, syncing the file if sync is
+// set.
+func (w *wal) settle(typ byte, seq uint64, sync bool) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.open(); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	writeWALRecord(&buf, walRecord{typ: typ, seq: seq})
+	if _, err := w.f.Write(buf.Bytes()); err != nil {
+		return newErr(err, "failed to append to write-ahead log")
+	}
+	if sync {
+		if err := w.f.Sync(); err != nil {
+			return newErr(err, "failed to sync write-ahead log")
+		}
+	}
+	return nil
+}
+
+func (w *wal) close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+func writeWALRecord(buf *bytes.Buffer, r walRecord) {
+	var header [walHeaderLen]byte
+	header[0] = r.typ
+	binary.LittleEndian.PutUint64(header[1:], r.seq)
+	writeUint32LE(header[:], 9, uint32(len(r.payload)))
+	buf.Write(header[:])
+	buf.Write(r.payload)
+}
+
+// readWALRecords reads every record of the log in f from its start, and
+// returns them with the length of the file they take up. A record cut short at
+// the end of the file, left by a crash while appending, is ignored: its write
+// was never sent to Redis.
+func readWALRecords(f *os.File) ([]walRecord, int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, newErr(err, "failed to read write-ahead log")
+	}
+	br := bufio.NewReader(f)
+	var records []walRecord
+	var size int64
+	for {
+		var header [walHeaderLen]byte
+		if _, err := io.ReadFull(br, header[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return records, size, nil
+		} else if err != nil {
+			return nil, 0, newErr(err, "failed to read write-ahead log")
+		}
+		r := walRecord{typ: header[0], seq: binary.LittleEndian.Uint64(header[1:])}
+		switch r.typ {
+		case walRecordNode, walRecordRoot, walRecordAck, walRecordAbort:
+		default:
+			return nil, 0, newErr(ErrCorruptWAL, fmt.Sprintf("unknown record type %d", r.typ))
+		}
+		r.payload = make([]byte, readUint32LE(header[:], 9))
+		if _, err := io.ReadFull(br, r.payload); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return records, size, nil
+		} else if err != nil {
+			return nil, 0, newErr(err, "failed to read write-ahead log")
+		}
+		records = append(records, r)
+		size += walHeaderLen + int64(len(r.payload))
+	}
+}
+
+// logWrites records the writes of items and, if not nil, of root in the
+// write-ahead log, returning the sequence number to ack once they reached
+// Redis. It does nothing without a write-ahead log.
+func (s *Storage) logWrites(items []*NodeItem, root *merkletree.Hash) (uint64, error) {
+	if s.wal == nil {
+		return 0, nil
+	}
+	records := make([]walRecord, 0, len(items)+1)
+	for _, item := range items {
+		d, err := MarshalNodeItem(item)
+		if err != nil {
+			return 0, err
+		}
+		records = append(records, walRecord{typ: walRecordNode, payload: d})
+	}
+	if root != nil {
+		records = append(records, walRecord{typ: walRecordRoot, payload: root[:]})
+	}
+	return s.wal.log(records...)
+}
+
+// abortWrites records in the write-ahead log that the writes logged under seq
+// failed, and returns err, the error reporting the failure. A failure to record
+// the abort is only logged, so that the original error reaches the caller.
+func (s *Storage) abortWrites(seq uint64, err error) error {
+	if aerr := s.wal.abort(seq); aerr != nil {
+		s.warnf("failed to abort write-ahead log entry %d: %v", seq, aerr)
+	}
+	return err
+}
+
+// Recover replays the writes recorded in the write-ahead log set with WithWAL
+// that were never acknowledged by Redis, such as those of a batch interrupted
+// by a crash, in the order they were logged. Writes that failed with an error
+// are not replayed. Replaying a write that did reach Redis is harmless for
+// nodes, which are keyed by their hash; an unacknowledged root write is
+// replayed like SetRoot, recording its timestamp, tree version and history,
+// even if another writer has set a newer root since, so call Recover at
+// startup, before the tree is written to. It does nothing without a
+// write-ahead log.
+func (s *Storage) Recover(ctx context.Context) error {
+	if s.wal == nil {
+		return nil
+	}
+	s.wal.mu.Lock()
+	defer s.wal.mu.Unlock()
+	return s.recoverLocked(ctx)
+}
+
+// Checkpoint replays unacknowledged writes like Recover and then truncates the
+// write-ahead log, which otherwise grows with every write. Writes wait for it
+// to finish, but writes in flight when it starts are replayed as well, so call
+// it between batches rather than concurrently with them.
+func (s *Storage) Checkpoint(ctx context.Context) error {
+	if s.wal == nil {
+		return nil
+	}
+	s.wal.mu.Lock()
+	defer s.wal.mu.Unlock()
+	if err := s.recoverLocked(ctx); err != nil {
+		return err
+	}
+	if err := s.wal.f.Truncate(0); err != nil {
+		return newErr(err, "failed to truncate write-ahead log")
+	}
+	return nil
+}
+
+// recoverLocked implements Recover. The caller must hold s.wal.mu.
+func (s *Storage) recoverLocked(ctx context.Context) error {
+	if err := s.wal.open(); err != nil {
+		return err
+	}
+	records, _, err := readWALRecords(s.wal.f)
+	if err != nil {
+		return err
+	}
+	settled := map[uint64]bool{}
+	for _, r := range records {
+		if r.typ == walRecordAck || r.typ == walRecordAbort {
+			settled[r.seq] = true
+		}
+	}
+	var replayed []uint64
+	for _, r := range records {
+		if settled[r.seq] {
+			continue
+		}
+		if err := s.replayWALRecord(ctx, r); err != nil {
+			return err
+		}
+		if len(replayed) == 0 || replayed[len(replayed)-1] != r.seq {
+			replayed = append(replayed, r.seq)
+		}
+	}
+	var buf bytes.Buffer
+	for _, seq := range replayed {
+		writeWALRecord(&buf, walRecord{typ: walRecordAck, seq: seq})
+	}
+	if _, err := s.wal.f.Write(buf.Bytes()); err != nil {
+		return newErr(err, "failed to append to write-ahead log")
+	}
+	return nil
+}
+
+func (s *Storage) replayWALRecord(ctx context.Context, r walRecord) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	switch r.typ {
+	case walRecordNode:
+		item, err := UnmarshalNodeItem(r.payload)
+		if err != nil {
+			return newErr(ErrCorruptWAL, err.Error())
+		}
+		v, err := s.encodeNodeItem(item)
+		if err != nil {
+			return err
+		}
+		if err := s.putValue(ctx, s.getRedisNodeIdForMerkleKey(item.Key), v); err != nil {
+			return newErr(err, "failed to replay node")
+		}
+		s.nodeCache.remove(item.Key)
+	case walRecordRoot:
+		var root merkletree.Hash
+		if len(r.payload) != len(root) {
+			return newErr(ErrCorruptWAL, "invalid root record")
+		}
+		copy(root[:], r.payload)
+		v, err := s.encodeRoot(&root)
+		if err != nil {
+			return err
+		}
+		if err := s.recordFormat(ctx); err != nil {
+			return err
+		}
+		if err := s.writeRoot(ctx, &root, v); err != nil {
+			return newErr(err, "failed to replay root")
+		}
+	}
+	return nil
+}
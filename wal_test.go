@@ -0,0 +1,210 @@
+package merkleredis
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OpenAssetStandards/go-merkletree-redis-store/internal/fakeredis"
+	"github.com/go-redis/redis/v9"
+)
+
+var errCrash = errors.New("process crashed")
+
+// crashingClient fails every write before it reaches the server with
+// errCrash. With crash set it panics with errCrash instead, like a process
+// killed after logging a write but before sending it, so that nothing runs
+// after the failure.
+type crashingClient struct {
+	redis.UniversalClient
+	crash bool
+}
+
+type crashedPipeline struct {
+	redis.Pipeliner
+	crash bool
+}
+
+func (p crashedPipeline) Exec(context.Context) ([]redis.Cmder, error) {
+	if p.crash {
+		panic(errCrash)
+	}
+	return nil, errCrash
+}
+
+func (c crashingClient) Pipeline() redis.Pipeliner {
+	return crashedPipeline{c.UniversalClient.Pipeline(), c.crash}
+}
+
+func (c crashingClient) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.StatusCmd {
+	if c.crash {
+		panic(errCrash)
+	}
+	cmd := redis.NewStatusCmd(ctx, "set", key, value)
+	cmd.SetErr(errCrash)
+	return cmd
+}
+
+// crash calls write, which must crash on a crashingClient.
+func crash(t *testing.T, write func() error) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != errCrash {
+			panic(r)
+		}
+	}()
+	err := write()
+	t.Fatalf("got %v, want the crash", err)
+}
+
+func TestWALRecover(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	path := filepath.Join(t.TempDir(), "tree.wal")
+
+	kvs := testLeafKVs(10)
+	s := NewMerkleRedisStorage(srv.Client(t), "wal", WithWAL(path))
+	if err := s.PutBatch(ctx, kvs[:5]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRoot(ctx, testHash(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second half of the batch and the new root are logged, but the
+	// process dies before they reach Redis
+	crashed := NewMerkleRedisStorageUniversal(crashingClient{srv.Client(t), true}, "wal", WithWAL(path))
+	crash(t, func() error { return crashed.PutBatch(ctx, kvs[5:]) })
+	crash(t, func() error { return crashed.SetRoot(ctx, testHash(2)) })
+	crash(t, func() error { return crashed.Put(ctx, []byte("single"), &kvs[0].V) })
+	crashed.Close()
+	for _, kv := range kvs[5:] {
+		if _, ok := srv.Raw(s.getRedisNodeIdForMerkleKey(kv.K)); ok {
+			t.Fatalf("node %x reached Redis", kv.K)
+		}
+	}
+	// a torn append at the moment of the crash
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{walRecordNode, 1, 2, 3})
+	f.Close()
+
+	restarted := NewMerkleRedisStorage(srv.Client(t), "wal", WithWAL(path))
+	defer restarted.Close()
+	sets := srv.Count("SET")
+	if err := restarted.Recover(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the five nodes, the root and its timestamp and the single node; acked
+	// writes aren't replayed
+	if n := srv.Count("SET") - sets; n != 8 {
+		t.Fatalf("Recover sent %d SETs, want 8", n)
+	}
+	fresh := NewMerkleRedisStorage(srv.Client(t), "wal")
+	for _, kv := range append(kvs, KV{K: []byte("single"), V: kvs[0].V}) {
+		if _, err := fresh.Get(ctx, kv.K); err != nil {
+			t.Fatalf("node %x after Recover: %v", kv.K, err)
+		}
+	}
+	checkRoot(t, fresh, testHash(2))
+
+	sets = srv.Count("SET")
+	if err := restarted.Recover(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Count("SET") - sets; n != 0 {
+		t.Fatalf("second Recover sent %d SETs", n)
+	}
+
+	// writes after recovery are logged on a record boundary
+	if err := restarted.Put(ctx, []byte("after"), &kvs[1].V); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Checkpoint(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() != 0 {
+		t.Fatalf("WAL after Checkpoint: %v, %v", fi, err)
+	}
+	if err := restarted.SetRoot(ctx, testHash(3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Recover(ctx); err != nil {
+		t.Fatal(err)
+	}
+	checkRoot(t, NewMerkleRedisStorage(srv.Client(t), "wal"), testHash(3))
+}
+
+func TestWALFailedWrites(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	path := filepath.Join(t.TempDir(), "tree.wal")
+
+	// writes that fail with an error are reported to the caller and not
+	// replayed over the writes that follow them
+	failing := NewMerkleRedisStorageUniversal(crashingClient{UniversalClient: srv.Client(t)}, "wal", WithWAL(path))
+	if err := failing.SetRoot(ctx, testHash(1)); !errors.Is(err, errCrash) {
+		t.Fatalf("SetRoot: got %v, want the failure", err)
+	}
+	if err := failing.PutBatch(ctx, testLeafKVs(2)); !errors.Is(err, errCrash) {
+		t.Fatalf("PutBatch: got %v, want the failure", err)
+	}
+	failing.Close()
+	s := NewMerkleRedisStorage(srv.Client(t), "wal", WithWAL(path))
+	defer s.Close()
+	if err := s.SetRoot(ctx, testHash(2)); err != nil {
+		t.Fatal(err)
+	}
+	sets := srv.Count("SET")
+	if err := s.Recover(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Count("SET") - sets; n != 0 {
+		t.Fatalf("Recover sent %d SETs, want none", n)
+	}
+	checkRoot(t, NewMerkleRedisStorage(srv.Client(t), "wal"), testHash(2))
+}
+
+func TestWALReplaysRootLikeSetRoot(t *testing.T) {
+	ctx := context.Background()
+	srv := fakeredis.New(t)
+	path := filepath.Join(t.TempDir(), "tree.wal")
+
+	crashed := NewMerkleRedisStorageUniversal(crashingClient{srv.Client(t), true}, "wal", WithWAL(path))
+	crash(t, func() error { return crashed.SetRoot(ctx, testHash(1)) })
+	crashed.Close()
+
+	s := NewMerkleRedisStorage(srv.Client(t), "wal", WithWAL(path), WithRootHistory(3))
+	defer s.Close()
+	if err := s.Recover(ctx); err != nil {
+		t.Fatal(err)
+	}
+	root, ts, err := s.GetRootWithTimestamp(ctx)
+	if err != nil || *root != *testHash(1) || ts.IsZero() {
+		t.Fatalf("got %v, %v, %v; want the replayed root with a timestamp", root, ts, err)
+	}
+	if v, err := s.TreeVersion(ctx); err != nil || v != 1 {
+		t.Fatalf("TreeVersion: got %d, %v, want 1", v, err)
+	}
+	if hist, err := s.GetRootHistory(ctx); err != nil || len(hist) != 1 || *hist[0] != *testHash(1) {
+		t.Fatalf("GetRootHistory: got %v, %v", hist, err)
+	}
+}
+
+func TestWALDerivedStores(t *testing.T) {
+	s := NewMerkleRedisStorage(nil, "wal", WithWAL(filepath.Join(t.TempDir(), "tree.wal")))
+	if s.wal == nil || s.WithPrefix("child").wal != nil {
+		t.Fatal("derived store shares the write-ahead log")
+	}
+	if err := NewMerkleRedisStorage(nil, "nowal").Recover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}